@@ -0,0 +1,117 @@
+// Command genv9 writes redisv9/registry, the copy of the registry package
+// built on github.com/redis/go-redis/v9. It is run by go generate in
+// registry/: every file but the hand-written ones is copied with the go-redis
+// import rewritten and the imports sorted again. The calls whose API differs between v8 and v9 live in
+// compat.go, which each package has its own version of.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	importV8 = `"github.com/go-redis/redis/v8"`
+	importV9 = `"github.com/redis/go-redis/v9"`
+	marker   = "// Code generated by genv9"
+	header   = marker + " from registry/%s. DO NOT EDIT.\n\n"
+)
+
+// handWritten files are not copied, the v9 package has its own.
+var handWritten = map[string]bool{
+	"compat.go": true,
+	"doc.go":    true,
+}
+
+// generate returns the files of the v9 copy of the package in src.
+func generate(src string) (map[string][]byte, error) {
+	names, err := filepath.Glob(filepath.Join(src, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte, len(names))
+	for _, name := range names {
+		base := filepath.Base(name)
+		if handWritten[base] {
+			continue
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		fmt.Fprintf(&out, header, base)
+		out.Write(bytes.ReplaceAll(data, []byte(importV8), []byte(importV9)))
+		if files[base], err = format.Source(out.Bytes()); err != nil {
+			return nil, fmt.Errorf("%s: %w", base, err)
+		}
+	}
+	return files, nil
+}
+
+// outdated returns the files of dst that differ from the generated ones and
+// the generated files of dst that are no longer generated.
+func outdated(dst string, files map[string][]byte) (write, remove []string, err error) {
+	for base, data := range files {
+		current, err := ioutil.ReadFile(filepath.Join(dst, base))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		if !bytes.Equal(current, data) {
+			write = append(write, base)
+		}
+	}
+	names, err := filepath.Glob(filepath.Join(dst, "*.go"))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range names {
+		base := filepath.Base(name)
+		if _, ok := files[base]; ok {
+			continue
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if strings.HasPrefix(string(data), marker) {
+			remove = append(remove, base)
+		}
+	}
+	sort.Strings(write)
+	sort.Strings(remove)
+	return write, remove, nil
+}
+
+func main() {
+	src := flag.String("src", ".", "directory of the registry package")
+	dst := flag.String("dst", filepath.Join("..", "redisv9", "registry"), "directory of its v9 copy")
+	flag.Parse()
+
+	files, err := generate(*src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	write, remove, err := outdated(*dst, files)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, base := range write {
+		if err := ioutil.WriteFile(filepath.Join(*dst, base), files[base], 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, base := range remove {
+		if err := os.Remove(filepath.Join(*dst, base)); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestCopyCurrent fails when a change to registry/ was not generated into
+// redisv9/registry.
+func TestCopyCurrent(t *testing.T) {
+	files, err := generate(filepath.Join("..", "..", "registry"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write, remove, err := outdated(filepath.Join("..", "..", "redisv9", "registry"), files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(write) > 0 || len(remove) > 0 {
+		t.Fatalf("redisv9/registry is outdated (%v to write, %v to remove), run go generate ./registry", write, remove)
+	}
+}
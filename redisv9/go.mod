@@ -0,0 +1,16 @@
+module github.com/exuan/kratos-redis/redisv9
+
+go 1.18
+
+require (
+	github.com/go-kratos/kratos/v2 v2.0.0-rc1
+	github.com/json-iterator/go v1.1.11
+	github.com/redis/go-redis/v9 v9.0.5
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
+	github.com/modern-go/reflect2 v0.0.0-20180701023420-4b7aa43c6742 // indirect
+)
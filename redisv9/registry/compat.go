@@ -0,0 +1,27 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// compatCmd is the part of redisCmd whose replies differ between v8 and v9.
+type compatCmd interface {
+	ConfigGet(ctx context.Context, parameter string) *redis.MapStringStringCmd
+	HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd
+}
+
+// keyspaceEvents returns the notify-keyspace-events setting of the server.
+func keyspaceEvents(ctx context.Context, client compatCmd) (string, error) {
+	values, err := client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return "", err
+	}
+	return values["notify-keyspace-events"], nil
+}
+
+// xaddArgs appends values to stream, trimmed to about maxLen entries.
+func xaddArgs(stream string, maxLen int64, values map[string]interface{}) *redis.XAddArgs {
+	return &redis.XAddArgs{Stream: stream, MaxLen: maxLen, Approx: true, Values: values}
+}
@@ -0,0 +1,7 @@
+// Package registry is github.com/exuan/kratos-redis/registry built on
+// github.com/redis/go-redis/v9 instead of github.com/go-redis/redis/v8, with
+// the same options, layouts and watchers, so that registries of both share a
+// namespace. Except for this file and compat.go, it is generated from
+// registry/ by go generate; a test of the root module fails when it is out
+// of date.
+package registry
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+// NamespaceWatcher watches every service of the namespace, see WatchAll.
+type NamespaceWatcher struct {
+	r       *Registry
+	ticker  *time.Ticker
+	started bool
+	sums    map[string]uint64
+	pending []string
+	groups  map[string][]*registry.ServiceInstance
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopper
+}
+
+// WatchAll watches every service in the namespace, for dashboards and
+// gateways needing a global view.
+func (r *Registry) WatchAll(ctx context.Context) (*NamespaceWatcher, error) {
+	w := &NamespaceWatcher{
+		r:       r,
+		ticker:  time.NewTicker(r.opts.watcherTtl),
+		sums:    make(map[string]uint64),
+		stopper: newStopper(),
+	}
+	w.ctx, w.cancel = context.WithCancel(r.watchContext(ctx))
+	return w, nil
+}
+
+// Next returns a service whose instances changed together with its current
+// instances, which are empty once the service is gone. The first calls return
+// every service right away.
+func (w *NamespaceWatcher) Next() (string, []*registry.ServiceInstance, error) {
+	name, items, err := w.next()
+	return name, items, w.err(err)
+}
+
+func (w *NamespaceWatcher) next() (string, []*registry.ServiceInstance, error) {
+	for len(w.pending) == 0 {
+		if w.started {
+			select {
+			case <-w.ctx.Done():
+				return "", nil, w.ctx.Err()
+			case <-w.ticker.C:
+			}
+		}
+		w.started = true
+		groups, err := w.r.GetServices(w.ctx, "*")
+		if err != nil {
+			return "", nil, err
+		}
+		w.groups = groups
+		for name, items := range groups {
+			if sum, ok := w.sums[name]; !ok || sum != fingerprint(items) {
+				w.sums[name] = fingerprint(items)
+				w.pending = append(w.pending, name)
+			}
+		}
+		for name := range w.sums {
+			if _, ok := groups[name]; !ok {
+				delete(w.sums, name)
+				w.pending = append(w.pending, name)
+			}
+		}
+		sort.Strings(w.pending)
+	}
+
+	name := w.pending[0]
+	w.pending = w.pending[1:]
+	return name, w.groups[name], nil
+}
+
+func (w *NamespaceWatcher) Stop() error {
+	w.stop(func() {
+		w.ticker.Stop()
+		w.cancel()
+	})
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+)
+
+// RegisterBatch registers many instances with one pipelined round trip, for
+// agents registering on behalf of other processes. Instances are registered
+// like Register does: already registered ones are only updated, and the
+// others wait for RegisterDelay or RegisterReadiness if set. Every write that
+// succeeds is kept alive even when others fail. With RegisterNX, conflicting
+// instances are skipped and reported in the returned error.
+func (r *Registry) RegisterBatch(ctx context.Context, services []*registry.ServiceInstance) error {
+	if r.ctx.Err() != nil {
+		return ErrClosed
+	}
+	for _, service := range services {
+		if err := r.prepare(ctx, service); err != nil {
+			return err
+		}
+	}
+
+	var (
+		writes  []*Lease
+		failed  []string
+		first   error
+		delayed = r.opts.delay > 0 || r.opts.ready != nil
+	)
+	for _, service := range services {
+		r.mu.Lock()
+		current, ok := r.leases[leaseID(service)]
+		r.mu.Unlock()
+		if ok && current.ctx.Err() == nil {
+			// already kept alive, only the stored value may need to change
+			if err := r.Update(ctx, service); err != nil {
+				failed = append(failed, current.id)
+				if first == nil {
+					first = err
+				}
+			}
+			continue
+		}
+		l := newLease(r, service)
+		if delayed {
+			l.pending = true
+			r.track(l)
+			r.goroutine(l.delayed)
+			continue
+		}
+		writes = append(writes, l)
+	}
+
+	var conflicts []string
+	for i, err := range r.writeBatch(ctx, writes) {
+		l := writes[i]
+		switch {
+		case err == nil:
+			r.track(l)
+			r.keepalive(l, r.interval())
+			r.registered(ctx, l.instance())
+		case errors.Is(err, ErrAlreadyRegistered):
+			conflicts = append(conflicts, l.id)
+		default:
+			failed = append(failed, l.id)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	if first != nil {
+		return fmt.Errorf("registry: %s not registered: %w", strings.Join(failed, ", "), first)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%w: %s", ErrAlreadyRegistered, strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// track makes l the lease of its instance, stopping the one it replaces.
+func (r *Registry) track(l *Lease) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.leases[l.id]; ok {
+		old.stop()
+	}
+	r.leases[l.id] = l
+}
+
+// writeBatch performs the initial writes of leases with one pipeline per
+// attempt, retrying the failed writes as configured with the OpRegister
+// RetryPolicy. It returns the error of each write, ErrAlreadyRegistered for
+// the instances RegisterNX found registered.
+func (r *Registry) writeBatch(ctx context.Context, leases []*Lease) []error {
+	errs := make([]error, len(leases))
+	if err := r.breaker.allow(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	script := r.layout.register
+	if r.opts.nx {
+		script = r.layout.registerNX
+	}
+	pending := make([]int, len(leases))
+	for i := range pending {
+		pending[i] = i
+	}
+	r.retry(ctx, OpRegister, func() error {
+		cmds := make([]*redis.Cmd, len(pending))
+		r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for j, i := range pending {
+				expiry := r.expiry(r.opts.ttl)
+				value, err := leases[i].value(expiry)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				cmds[j] = r.run(ctx, pipe, script, r.scriptKeys(leases[i]), r.scriptArgs(leases[i], value, expiry)...)
+			}
+			return nil
+		})
+		var (
+			retry []int
+			first error
+		)
+		for j, i := range pending {
+			if cmds[j] == nil {
+				continue
+			}
+			ok, err := cmds[j].Int()
+			switch {
+			case err != nil:
+				if isFunctionMissing(err) {
+					// reloaded by the retry
+					r.fns.reset()
+				}
+				retry = append(retry, i)
+				if first == nil {
+					first = err
+				}
+			case r.opts.nx && ok == 0:
+				err = ErrAlreadyRegistered
+			}
+			errs[i] = err
+		}
+		r.breaker.record(first)
+		pending = retry
+		return first
+	})
+	return errs
+}
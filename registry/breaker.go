@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// ErrCircuitOpen is returned without contacting Redis while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("registry: circuit breaker open")
+
+// CircuitBreaker makes discovery, Register, Update and Deregister fail fast
+// with ErrCircuitOpen for cooldown once failures operations in a row found
+// Redis unreachable, instead of each waiting for its timeout. Discovery then
+// serves the StaleFallback instances. After the cooldown a single operation
+// probes Redis, closing the breaker when it succeeds. Heartbeats are never
+// rejected, their outcomes count as well.
+func CircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(o *options) {
+		o.breakerFailures = failures
+		o.breakerCooldown = cooldown
+	}
+}
+
+type breaker struct {
+	r        *Registry
+	mu       sync.Mutex
+	failures int
+	open     time.Time
+	probing  bool
+}
+
+// allow returns ErrCircuitOpen when an operation must not be attempted.
+func (b *breaker) allow() error {
+	if b.r.opts.breakerFailures <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.open.IsZero():
+		return nil
+	case b.probing || time.Since(b.open) < b.r.opts.breakerCooldown:
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// record counts the outcome of an operation that was allowed. Only errors
+// telling Redis is unreachable count as failures.
+func (b *breaker) record(err error) {
+	if b.r.opts.breakerFailures <= 0 || errors.Is(err, ErrCircuitOpen) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !unreachable(err) {
+		if !b.open.IsZero() {
+			b.r.opts.logger.Log(log.LevelInfo, "msg", "registry: circuit breaker closed")
+		}
+		b.failures, b.open = 0, time.Time{}
+		return
+	}
+	if b.failures++; b.failures >= b.r.opts.breakerFailures {
+		if b.open.IsZero() {
+			b.r.opts.logger.Log(log.LevelWarn, "msg", "registry: circuit breaker open", "error", err)
+		}
+		b.open = time.Now()
+	}
+}
+
+// guarded runs fn unless the breaker is open, recording its outcome.
+func (b *breaker) guarded(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
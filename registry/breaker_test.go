@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	down := context.DeadlineExceeded
+	refused := proto("NOPERM this user has no permissions")
+	// step records err when allowed, after waiting for the cooldown if set,
+	// and checks whether the operation was allowed
+	type step struct {
+		wait    bool
+		allowed bool
+		err     error
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"stays closed below the threshold", []step{
+			{allowed: true, err: down}, {allowed: true, err: nil}, {allowed: true, err: down}, {allowed: true},
+		}},
+		{"replies do not count", []step{
+			{allowed: true, err: refused}, {allowed: true, err: refused}, {allowed: true, err: refused}, {allowed: true},
+		}},
+		{"opens after failures in a row", []step{
+			{allowed: true, err: down}, {allowed: true, err: down}, {allowed: false}, {allowed: false},
+		}},
+		{"probe closes", []step{
+			{allowed: true, err: down}, {allowed: true, err: down}, {allowed: false},
+			{wait: true, allowed: true, err: nil}, {allowed: true}, {allowed: true},
+		}},
+		{"failed probe reopens", []step{
+			{allowed: true, err: down}, {allowed: true, err: down},
+			{wait: true, allowed: true, err: down}, {allowed: false},
+			{wait: true, allowed: true, err: nil}, {allowed: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &newTestRegistry(t, nil, CircuitBreaker(2, cooldown)).breaker
+			for i, s := range tt.steps {
+				if s.wait {
+					time.Sleep(cooldown + 5*time.Millisecond)
+				}
+				err := b.allow()
+				if allowed := err == nil; allowed != s.allowed {
+					t.Fatalf("step %d: allowed = %v, want %v", i, allowed, s.allowed)
+				}
+				if err == nil {
+					b.record(s.err)
+				} else if !errors.Is(err, ErrCircuitOpen) {
+					t.Fatalf("step %d: got %v, want ErrCircuitOpen", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	b := &newTestRegistry(t, nil, CircuitBreaker(1, time.Millisecond)).breaker
+	b.record(context.DeadlineExceeded)
+	time.Sleep(5 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe after the cooldown: %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second operation during the probe: got %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := &newTestRegistry(t, nil).breaker
+	for i := 0; i < 10; i++ {
+		b.record(context.DeadlineExceeded)
+	}
+	if err := b.allow(); err != nil {
+		t.Fatalf("disabled breaker rejected an operation: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+	jsoniter "github.com/json-iterator/go"
+)
+
+var (
+	_ registry.Discovery = (*CachedDiscovery)(nil)
+)
+
+// CachedDiscovery memoizes GetService results of a Registry for a short TTL
+// and collapses concurrent lookups of the same service into one. Entries are
+// invalidated by the events of the namespace, so it protects Redis from
+// per-request resolution without delaying changes.
+type CachedDiscovery struct {
+	r        *Registry
+	ttl      time.Duration
+	negative time.Duration
+	pubsub   *redis.PubSub
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	calls   map[string]*call
+	version uint64
+}
+
+type cacheEntry struct {
+	items   []*registry.ServiceInstance
+	expires time.Time
+}
+
+// call is an in-flight lookup shared by concurrent callers.
+type call struct {
+	wg    sync.WaitGroup
+	items []*registry.ServiceInstance
+	err   error
+}
+
+// CacheOption configures a CachedDiscovery.
+type CacheOption func(d *CachedDiscovery)
+
+// NegativeTTL caches lookups finding no instance for ttl, so that a mistyped
+// service name does not scan the keyspace on every request. By default empty
+// results are not cached.
+func NegativeTTL(ttl time.Duration) CacheOption {
+	return func(d *CachedDiscovery) { d.negative = ttl }
+}
+
+// NewCachedDiscovery wraps r with a cache keeping results for ttl.
+func NewCachedDiscovery(r *Registry, ttl time.Duration, opts ...CacheOption) *CachedDiscovery {
+	d := &CachedDiscovery{
+		r:       r,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+		calls:   make(map[string]*call),
+	}
+	for _, o := range opts {
+		o(d)
+	}
+	if !r.opts.noEvents {
+		d.pubsub = r.client.Subscribe(r.ctx, r.EventChannel())
+		go d.invalidate(d.pubsub.Channel())
+	}
+	return d
+}
+
+func (d *CachedDiscovery) GetService(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	key := d.r.join(d.r.opts.namespace, serviceName)
+
+	d.mu.Lock()
+	if e, ok := d.entries[key]; ok && time.Now().Before(e.expires) {
+		d.mu.Unlock()
+		return copyInstances(e.items), nil
+	}
+	if c, ok := d.calls[key]; ok {
+		d.mu.Unlock()
+		c.wg.Wait()
+		return copyInstances(c.items), c.err
+	}
+	c := new(call)
+	c.wg.Add(1)
+	d.calls[key] = c
+	version := d.version
+	d.mu.Unlock()
+
+	c.items, c.err = d.r.GetService(ctx, serviceName)
+	c.wg.Done()
+
+	d.mu.Lock()
+	delete(d.calls, key)
+	ttl := d.ttl
+	if len(c.items) == 0 {
+		ttl = d.negative
+	}
+	// drop results that raced an invalidation
+	if c.err == nil && ttl > 0 && version == d.version {
+		d.entries[key] = cacheEntry{items: c.items, expires: time.Now().Add(ttl)}
+	}
+	d.mu.Unlock()
+	return copyInstances(c.items), c.err
+}
+
+func (d *CachedDiscovery) Watch(ctx context.Context, serviceName string) (registry.Watcher, error) {
+	return d.r.Watch(ctx, serviceName)
+}
+
+// Close stops listening for events. Cached entries then only expire by TTL.
+func (d *CachedDiscovery) Close() error {
+	if d.pubsub == nil {
+		return nil
+	}
+	return d.pubsub.Close()
+}
+
+func (d *CachedDiscovery) invalidate(ch <-chan *redis.Message) {
+	for msg := range ch {
+		var ev Event
+		if err := jsoniter.UnmarshalFromString(msg.Payload, &ev); err != nil {
+			continue
+		}
+		d.mu.Lock()
+		delete(d.entries, ev.Service)
+		d.version++
+		d.mu.Unlock()
+	}
+}
+
+// copyInstances keeps callers from reordering the cached slice.
+func copyInstances(items []*registry.ServiceInstance) []*registry.ServiceInstance {
+	if items == nil {
+		return nil
+	}
+	return append(make([]*registry.ServiceInstance, 0, len(items)), items...)
+}
@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	_ redisCmd = (redis.UniversalClient)(nil)
+)
+
+// redisCmd is every command the Registry issues. Any redis.UniversalClient
+// implements it, and so can a wrapper adding retries, metrics or routing
+// across regions. Wrappers are treated like a single node: the type of the
+// wrapped client is not seen, so a wrapped Cluster is scanned through a single
+// node unless the instances are read from an Index.
+type redisCmd interface {
+	redis.Scripter
+	compatCmd
+
+	Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+	Do(ctx context.Context, args ...interface{}) *redis.Cmd
+	Ping(ctx context.Context) *redis.StatusCmd
+
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+	Exists(ctx context.Context, keys ...string) *redis.IntCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	SetXX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	SMembers(ctx context.Context, key string) *redis.StringSliceCmd
+	SCard(ctx context.Context, key string) *redis.IntCmd
+	SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	HLen(ctx context.Context, key string) *redis.IntCmd
+	ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd
+	ZCount(ctx context.Context, key, min, max string) *redis.IntCmd
+	ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd
+
+	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+	PSubscribe(ctx context.Context, channels ...string) *redis.PubSub
+
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	XRead(ctx context.Context, a *redis.XReadArgs) *redis.XStreamSliceCmd
+	XRange(ctx context.Context, stream, start, stop string) *redis.XMessageSliceCmd
+	XRevRangeN(ctx context.Context, stream, start, stop string, count int64) *redis.XMessageSliceCmd
+
+	Close() error
+}
@@ -0,0 +1,32 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The go-redis v9 copy of this package, redisv9/registry, is generated from
+// every file but this one, which holds the calls whose API differs in v9.
+//go:generate go run ../internal/genv9
+
+// compatCmd is the part of redisCmd whose replies differ between v8 and v9.
+type compatCmd interface {
+	ConfigGet(ctx context.Context, parameter string) *redis.SliceCmd
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+}
+
+// keyspaceEvents returns the notify-keyspace-events setting of the server.
+func keyspaceEvents(ctx context.Context, client compatCmd) (string, error) {
+	values, err := client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil || len(values) != 2 {
+		return "", err
+	}
+	flags, _ := values[1].(string)
+	return flags, nil
+}
+
+// xaddArgs appends values to stream, trimmed to about maxLen entries.
+func xaddArgs(stream string, maxLen int64, values map[string]interface{}) *redis.XAddArgs {
+	return &redis.XAddArgs{Stream: stream, MaxLenApprox: maxLen, Values: values}
+}
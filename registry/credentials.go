@@ -0,0 +1,37 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// CredentialsProvider returns the credentials to authenticate with, an empty
+// username authenticates with the password only.
+type CredentialsProvider func(ctx context.Context) (username, password string, err error)
+
+// Credentials makes the client built by NewFromURL ask provider for the
+// credentials every time it opens a connection, instead of using those of the
+// URL, so that a rotated password or ACL token is picked up without a restart.
+// Established connections stay authenticated, registrations survive the
+// rotation. New ignores it, see AuthOnConnect.
+func Credentials(provider CredentialsProvider) Option {
+	return func(o *options) { o.credentials = provider }
+}
+
+// AuthOnConnect returns a redis.Options.OnConnect hook authenticating every
+// new connection with the credentials of provider, for clients created by
+// the application. Username and Password of the options must stay empty.
+func AuthOnConnect(provider CredentialsProvider) func(ctx context.Context, cn *redis.Conn) error {
+	return func(ctx context.Context, cn *redis.Conn) error {
+		username, password, err := provider(ctx)
+		if err != nil {
+			return fmt.Errorf("registry: credentials: %w", err)
+		}
+		if username == "" {
+			return cn.Auth(ctx, password).Err()
+		}
+		return cn.AuthACL(ctx, username, password).Err()
+	}
+}
@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+var (
+	_ registry.Watcher = (*DeltaWatcher)(nil)
+)
+
+// Delta is the change between two successive results of a watcher.
+type Delta struct {
+	Added   []*registry.ServiceInstance
+	Removed []*registry.ServiceInstance
+	Updated []*registry.ServiceInstance
+}
+
+// DeltaWatcher extends a watcher with typed deltas, so that consumers can
+// update routing tables incrementally instead of diffing full lists.
+type DeltaWatcher struct {
+	w       registry.Watcher
+	current map[string]*registry.ServiceInstance
+}
+
+// NewDeltaWatcher wraps w. Its first delta adds all current instances.
+func NewDeltaWatcher(w registry.Watcher) *DeltaWatcher {
+	return &DeltaWatcher{w: w, current: make(map[string]*registry.ServiceInstance)}
+}
+
+// WatchDeltas watches the service, see NewDeltaWatcher.
+func (r *Registry) WatchDeltas(ctx context.Context, serviceName string) (*DeltaWatcher, error) {
+	w, err := newWatcher(ctx, r, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return NewDeltaWatcher(w), nil
+}
+
+// Next returns the full instance list, like the wrapped watcher.
+func (d *DeltaWatcher) Next() ([]*registry.ServiceInstance, error) {
+	items, err := d.w.Next()
+	if err != nil {
+		return nil, err
+	}
+	d.diff(items)
+	return items, nil
+}
+
+// NextDelta blocks until the instances changed and returns the change.
+func (d *DeltaWatcher) NextDelta() (*Delta, error) {
+	for {
+		items, err := d.w.Next()
+		if err != nil {
+			return nil, err
+		}
+		delta := d.diff(items)
+		if len(delta.Added)+len(delta.Removed)+len(delta.Updated) > 0 {
+			return delta, nil
+		}
+	}
+}
+
+func (d *DeltaWatcher) Stop() error {
+	return d.w.Stop()
+}
+
+// diff records items as the current instances and returns how they changed.
+// Synthetic metadata is ignored when comparing instances.
+func (d *DeltaWatcher) diff(items []*registry.ServiceInstance) *Delta {
+	delta := new(Delta)
+	next := make(map[string]*registry.ServiceInstance, len(items))
+	for _, si := range items {
+		next[si.ID] = si
+		old, ok := d.current[si.ID]
+		switch {
+		case !ok:
+			delta.Added = append(delta.Added, si)
+		case fingerprint([]*registry.ServiceInstance{old}) != fingerprint([]*registry.ServiceInstance{si}):
+			delta.Updated = append(delta.Updated, si)
+		}
+	}
+	for id, si := range d.current {
+		if _, ok := next[id]; !ok {
+			delta.Removed = append(delta.Removed, si)
+		}
+	}
+	sort.Slice(delta.Removed, func(i, j int) bool {
+		return delta.Removed[i].ID < delta.Removed[j].ID
+	})
+	d.current = next
+	return delta
+}
@@ -0,0 +1,42 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+func TestDeltaWatcherDiff(t *testing.T) {
+	instance := func(id string, md ...string) *registry.ServiceInstance {
+		si := &registry.ServiceInstance{ID: id, Name: "user", Metadata: map[string]string{}}
+		for i := 0; i+1 < len(md); i += 2 {
+			si.Metadata[md[i]] = md[i+1]
+		}
+		return si
+	}
+	// the steps run in order against one DeltaWatcher
+	steps := []struct {
+		name                    string
+		items                   []*registry.ServiceInstance
+		added, removed, updated []string
+	}{
+		{"first adds all", []*registry.ServiceInstance{instance("1"), instance("2")}, []string{"1", "2"}, nil, nil},
+		{"unchanged", []*registry.ServiceInstance{instance("1"), instance("2")}, nil, nil, nil},
+		{"reordered", []*registry.ServiceInstance{instance("2"), instance("1")}, nil, nil, nil},
+		{"heartbeat", []*registry.ServiceInstance{
+			instance("1", MetadataLastHeartbeat, "200", MetadataTTLRemaining, "900"),
+			instance("2", MetadataExpiresAt, "300"),
+		}, nil, nil, nil},
+		{"metadata changed", []*registry.ServiceInstance{instance("1", "weight", "50"), instance("2")}, nil, nil, []string{"1"}},
+		{"reserved looking key changed", []*registry.ServiceInstance{instance("1", "weight", "50"), instance("2", "__owner", "ops")}, nil, nil, []string{"2"}},
+		{"added and removed", []*registry.ServiceInstance{instance("3"), instance("1", "weight", "50")}, []string{"3"}, []string{"2"}, nil},
+		{"all removed", nil, nil, []string{"1", "3"}, nil},
+	}
+	d := NewDeltaWatcher(nil)
+	for _, step := range steps {
+		delta := d.diff(step.items)
+		assertIDs(t, step.name+": Added", delta.Added, step.added...)
+		assertIDs(t, step.name+": Removed", delta.Removed, step.removed...)
+		assertIDs(t, step.name+": Updated", delta.Updated, step.updated...)
+	}
+}
@@ -0,0 +1,543 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// MetadataDraining is set to "true" on instances being drained.
+	MetadataDraining = "draining"
+	// MetadataTerminating is set to "true" on instances deregistering with a grace period.
+	MetadataTerminating = "terminating"
+)
+
+// ExcludeDraining hides draining and terminating instances from GetService and watchers.
+func ExcludeDraining() Option {
+	return func(o *options) {
+		o.filters = append(o.filters, func(si *registry.ServiceInstance) bool {
+			return si.Metadata[MetadataDraining] != "true" && si.Metadata[MetadataTerminating] != "true"
+		})
+	}
+}
+
+// SkipMalformed makes discovery skip entries that cannot be decoded instead of
+// failing, so a single bad writer cannot break discovery. report is called
+// with the key and the decode error of every skipped entry.
+func SkipMalformed(report func(key string, err error)) Option {
+	return func(o *options) { o.onMalformed = report }
+}
+
+// malformed returns err wrapped in ErrMalformed unless malformed entries are
+// skipped.
+func (r *Registry) malformed(key string, err error) error {
+	if r.opts.onMalformed == nil {
+		return fmt.Errorf("%w: %s: %v", ErrMalformed, key, err)
+	}
+	r.opts.onMalformed(key, err)
+	return nil
+}
+
+// MinRemainingTTL drops discovered instances whose key expires within
+// threshold, as they most likely belong to a crashed process that stopped
+// heartbeating. It costs one pipelined PTTL per instance.
+func MinRemainingTTL(threshold time.Duration) Option {
+	return func(o *options) { o.minTTL = threshold }
+}
+
+// alive drops the items whose key expires within the minimum remaining TTL.
+func (r *Registry) alive(ctx context.Context, items []*registry.ServiceInstance) ([]*registry.ServiceInstance, error) {
+	if r.opts.hash {
+		// fields do not expire, their expiration is stored with them
+		healthy := items[:0]
+		for _, si := range items {
+			left, err := strconv.ParseInt(si.Metadata[MetadataTTLRemaining], 10, 64)
+			if err != nil || time.Duration(left)*time.Millisecond >= r.opts.minTTL {
+				healthy = append(healthy, si)
+			}
+		}
+		return healthy, nil
+	}
+	cmds := make([]*redis.DurationCmd, len(items))
+	_, err := r.reader.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, si := range items {
+			cmds[i] = pipe.PTTL(ctx, r.key(si.Name, si.ID))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	healthy := items[:0]
+	for i, si := range items {
+		// -1 is a key without expiration, -2 a key that is gone
+		if ttl := cmds[i].Val(); ttl == -1 || ttl >= r.opts.minTTL {
+			healthy = append(healthy, si)
+		}
+	}
+	return healthy, nil
+}
+
+// SortBy orders discovered instances with less instead of by ID.
+func SortBy(less func(a, b *registry.ServiceInstance) bool) Option {
+	return func(o *options) { o.less = less }
+}
+
+func byID(a, b *registry.ServiceInstance) bool {
+	return a.ID < b.ID
+}
+
+// instances returns the instances of the service that pass the configured
+// filters, in a stable order so that consumers can compare results.
+func (r *Registry) instances(ctx context.Context, service string) ([]*registry.ServiceInstance, error) {
+	var items []*registry.ServiceInstance
+	err := r.breaker.guarded(func() (err error) {
+		items, err = r.discoverRetry(ctx, service)
+		return err
+	})
+	return r.fallback(service, items, err)
+}
+
+func (r *Registry) discover(ctx context.Context, service string) ([]*registry.ServiceInstance, error) {
+	items, err := r.read(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	return r.refine(ctx, items)
+}
+
+// read returns every stored instance of the service, before refine.
+func (r *Registry) read(ctx context.Context, service string) ([]*registry.ServiceInstance, error) {
+	var (
+		items []*registry.ServiceInstance
+		err   error
+	)
+	switch {
+	case r.opts.hash:
+		items, err = r.hashed(ctx, service)
+	case r.opts.snapshot:
+		items, err = r.snapshot(ctx, service)
+	case r.opts.zset:
+		items, err = r.scored(ctx, service)
+	case r.opts.index:
+		items, err = r.indexed(ctx, service)
+	default:
+		items, err = r.services(ctx, r.pattern(service))
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a KeyEncoder pattern may still match the keys of sibling services
+	return filter(items, []func(*registry.ServiceInstance) bool{func(si *registry.ServiceInstance) bool {
+		return si.Name == service
+	}}), nil
+}
+
+// refine applies the configured filters and ordering to discovered items.
+func (r *Registry) refine(ctx context.Context, items []*registry.ServiceInstance) ([]*registry.ServiceInstance, error) {
+	var err error
+	items = dedupe(items)
+	filtered := filter(items, r.opts.filters)
+	if r.opts.minTTL > 0 && len(filtered) > 0 {
+		if filtered, err = r.alive(ctx, filtered); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return r.opts.less(filtered[i], filtered[j])
+	})
+	if r.opts.locality != nil {
+		filtered = r.opts.locality.apply(filtered)
+	}
+	return filtered, nil
+}
+
+// filter returns the items passing all filters, reusing the slice.
+func filter(items []*registry.ServiceInstance, filters []func(*registry.ServiceInstance) bool) []*registry.ServiceInstance {
+	if len(filters) == 0 {
+		return items
+	}
+	kept := items[:0]
+next:
+	for _, si := range items {
+		for _, keep := range filters {
+			if !keep(si) {
+				continue next
+			}
+		}
+		kept = append(kept, si)
+	}
+	return kept
+}
+
+// dedupe keeps the newest record of every instance ID, e.g. when an instance
+// is stored under an old and a new key layout.
+func dedupe(items []*registry.ServiceInstance) []*registry.ServiceInstance {
+	newest := make(map[string]int, len(items))
+	unique := items[:0]
+	for _, si := range items {
+		i, ok := newest[si.ID]
+		if !ok {
+			newest[si.ID] = len(unique)
+			unique = append(unique, si)
+			continue
+		}
+		if freshness(si) > freshness(unique[i]) {
+			unique[i] = si
+		}
+	}
+	return unique
+}
+
+// freshness is the time of the last write of a discovered instance.
+func freshness(si *registry.ServiceInstance) int64 {
+	for _, key := range []string{MetadataLastHeartbeat, MetadataRegisteredAt} {
+		if ms, err := strconv.ParseInt(si.Metadata[key], 10, 64); err == nil {
+			return ms
+		}
+	}
+	return 0
+}
+
+// withMetadata returns a copy of service with the metadata key set.
+func withMetadata(service *registry.ServiceInstance, key, value string) *registry.ServiceInstance {
+	si := *service
+	si.Metadata = make(map[string]string, len(service.Metadata)+1)
+	for k, v := range service.Metadata {
+		si.Metadata[k] = v
+	}
+	si.Metadata[key] = value
+	return &si
+}
+
+// scan walks the keys of the namespace matching pattern page by page,
+// together with their values.
+func (r *Registry) scan(ctx context.Context, client redisCmd, pattern string, fn func(keys []string, values []interface{}) error) error {
+	return r.scanKeys(ctx, client, pattern, func(keys []string) error {
+		values, err := mget(ctx, client, keys)
+		if err != nil {
+			return err
+		}
+		return fn(keys, values)
+	})
+}
+
+// mget reads the values of keys, nil for missing keys, with one pipeline. On
+// Cluster and Ring clients keys are read one by one as they may live on
+// different nodes.
+func mget(ctx context.Context, client redisCmd, keys []string) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(keys))
+	switch client.(type) {
+	case *redis.ClusterClient, *redis.Ring:
+		cmds := make([]*redis.StringCmd, len(keys))
+		_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				cmds[i] = pipe.Get(ctx, key)
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for _, cmd := range cmds {
+			if v, err := cmd.Result(); err == nil {
+				values = append(values, v)
+			} else {
+				values = append(values, nil)
+			}
+		}
+		return values, nil
+	}
+
+	cmds := make([]*redis.SliceCmd, 0, len(keys)/defaultScan+1)
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := 0; i < len(keys); i += defaultScan {
+			end := i + defaultScan
+			if end > len(keys) {
+				end = len(keys)
+			}
+			cmds = append(cmds, pipe.MGet(ctx, keys[i:end]...))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		values = append(values, cmd.Val()...)
+	}
+	return values, nil
+}
+
+// scanKeys walks the non-empty pages of keys matching pattern, on every
+// master of Cluster and every shard of Ring clients.
+func scanKeys(ctx context.Context, client redisCmd, pattern string, fn func(keys []string) error) error {
+	var mu sync.Mutex
+	node := func(ctx context.Context, c *redis.Client) error {
+		return scanNode(ctx, c, pattern, func(keys []string) error {
+			// nodes are scanned concurrently
+			mu.Lock()
+			defer mu.Unlock()
+			return fn(keys)
+		})
+	}
+	switch c := client.(type) {
+	case *redis.ClusterClient:
+		return c.ForEachMaster(ctx, node)
+	case *redis.Ring:
+		return c.ForEachShard(ctx, node)
+	}
+	return scanNode(ctx, client, pattern, fn)
+}
+
+// scanKeys is scanKeys skipping the keys of nested namespaces.
+func (r *Registry) scanKeys(ctx context.Context, client redisCmd, pattern string, fn func(keys []string) error) error {
+	return scanKeys(ctx, client, pattern, func(keys []string) error {
+		own := keys[:0]
+		for _, key := range keys {
+			if !r.nested(key) {
+				own = append(own, key)
+			}
+		}
+		if len(own) == 0 {
+			return nil
+		}
+		return fn(own)
+	})
+}
+
+func scanNode(ctx context.Context, client redisCmd, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, pattern, defaultScan).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (r *Registry) services(ctx context.Context, pattern string) ([]*registry.ServiceInstance, error) {
+	items := make([]*registry.ServiceInstance, 0)
+	err := r.scan(ctx, r.reader, pattern, func(keys []string, values []interface{}) error {
+		for i, v := range values {
+			switch str := v.(type) {
+			case string:
+				si, err := decode(str)
+				if err != nil {
+					if err = r.malformed(keys[i], err); err != nil {
+						return err
+					}
+					continue
+				}
+				items = append(items, si)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListServices returns the sorted names of all services registered in the
+// namespace. With Index or HashLayout it lists the service indexes or hashes,
+// which may still name a service whose last instance just expired.
+func (r *Registry) ListServices(ctx context.Context) ([]string, error) {
+	seen := make(map[string]struct{})
+	switch {
+	case r.opts.hash:
+		err := r.scanKeys(ctx, r.reader, r.namespacePattern(), func(keys []string) error {
+			for _, key := range keys {
+				escaped, ok := r.hashService(key)
+				if !ok {
+					continue
+				}
+				if name, err := url.PathUnescape(escaped); err == nil {
+					seen[name] = struct{}{}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	case r.opts.index:
+		prefix, suffix := r.indexAffixes()
+		err := r.scanKeys(ctx, r.reader, prefix+"*"+suffix, func(keys []string) error {
+			for _, key := range keys {
+				if name, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(key, prefix), suffix)); err == nil {
+					seen[name] = struct{}{}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		err := r.scan(ctx, r.reader, r.namespacePattern(), func(keys []string, values []interface{}) error {
+			for _, v := range values {
+				str, ok := v.(string)
+				if !ok {
+					continue
+				}
+				if si, err := decode(str); err == nil {
+					seen[si.Name] = struct{}{}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// EndpointScheme only discovers instances exposing at least one endpoint with
+// one of the schemes, e.g. "grpc".
+func EndpointScheme(schemes ...string) Option {
+	return Filter(func(si *registry.ServiceInstance) bool {
+		for _, e := range si.Endpoints {
+			u, err := url.Parse(e)
+			if err != nil {
+				continue
+			}
+			for _, scheme := range schemes {
+				if strings.EqualFold(u.Scheme, scheme) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// CountInstances returns the number of registered instances of the service
+// without decoding them. Filters are not applied and, with Index or
+// HashLayout, instances expired since the last discovery may still be counted.
+func (r *Registry) CountInstances(ctx context.Context, service string) (int, error) {
+	if r.opts.hash {
+		n, err := r.reader.HLen(ctx, r.hashKey(service)).Result()
+		return int(n), err
+	}
+	if r.opts.zset {
+		n, err := r.countScored(ctx, service)
+		return int(n), err
+	}
+	if r.opts.index {
+		n, err := r.reader.SCard(ctx, r.index(service)).Result()
+		return int(n), err
+	}
+	var n int
+	err := r.scanKeys(ctx, r.reader, r.pattern(service), func(keys []string) error {
+		n += len(keys)
+		return nil
+	})
+	return n, err
+}
+
+// errFound stops a scan at the first match.
+var errFound = errors.New("found")
+
+// HasService cheaply reports whether any instance of the service is
+// registered, reading at most until the first match. With Index or
+// HashLayout it may still report a service whose last instance just expired.
+func (r *Registry) HasService(ctx context.Context, service string) (bool, error) {
+	if r.opts.hash {
+		n, err := r.reader.Exists(ctx, r.hashKey(service)).Result()
+		return n > 0, err
+	}
+	if r.opts.zset {
+		n, err := r.countScored(ctx, service)
+		return n > 0, err
+	}
+	if r.opts.index {
+		n, err := r.reader.Exists(ctx, r.index(service)).Result()
+		return n > 0, err
+	}
+	err := r.scanKeys(ctx, r.reader, r.pattern(service), func(keys []string) error {
+		return errFound
+	})
+	if err == errFound {
+		return true, nil
+	}
+	return false, err
+}
+
+// GetServices returns the instances of every service whose name matches the
+// glob pattern, e.g. "payment-*", keyed by service name.
+func (r *Registry) GetServices(ctx context.Context, pattern string) (map[string][]*registry.ServiceInstance, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	result := make(map[string][]*registry.ServiceInstance)
+	if r.opts.index || r.opts.snapshot || r.opts.hash {
+		names, err := r.ListServices(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); !ok {
+				continue
+			}
+			items, err := r.instances(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			if len(items) > 0 {
+				result[name] = items
+			}
+		}
+		return result, nil
+	}
+
+	items, err := r.services(ctx, r.namespacePattern())
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]*registry.ServiceInstance)
+	for _, si := range items {
+		if ok, _ := path.Match(pattern, si.Name); ok {
+			groups[si.Name] = append(groups[si.Name], si)
+		}
+	}
+	for name, group := range groups {
+		refined, err := r.refine(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		if len(refined) > 0 {
+			result[name] = refined
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,221 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+)
+
+// fakeClient serves the reads of the default layout from a map of string
+// keys, matching SCAN patterns like Redis does.
+type fakeClient struct {
+	redisCmd
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (c *fakeClient) set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]string)
+	}
+	c.values[key] = value
+}
+
+func (c *fakeClient) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []string
+	for key := range c.values {
+		if globMatch(match, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return redis.NewScanCmdResult(keys, 0, nil)
+}
+
+func (c *fakeClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return nil, fn(fakePipeliner{c: c})
+}
+
+// fakePipeliner runs the commands of a pipeline as they are queued.
+type fakePipeliner struct {
+	redis.Pipeliner
+	c *fakeClient
+}
+
+func (p fakePipeliner) Get(ctx context.Context, key string) *redis.StringCmd {
+	p.c.mu.Lock()
+	defer p.c.mu.Unlock()
+	if v, ok := p.c.values[key]; ok {
+		return redis.NewStringResult(v, nil)
+	}
+	return redis.NewStringResult("", redis.Nil)
+}
+
+func (p fakePipeliner) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	p.c.mu.Lock()
+	defer p.c.mu.Unlock()
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		if v, ok := p.c.values[key]; ok {
+			values[i] = v
+		}
+	}
+	return redis.NewSliceResult(values, nil)
+}
+
+// store writes the instance the way a Registry configured with opts does.
+func (c *fakeClient) store(t *testing.T, si *registry.ServiceInstance, opts ...Option) {
+	t.Helper()
+	r := newTestRegistry(t, nil, opts...)
+	now := time.Now()
+	value, err := r.encode(si, now, now, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.set(r.key(si.Name, si.ID), value)
+}
+
+func TestDiscoveryExcludesOtherServices(t *testing.T) {
+	layouts := []struct {
+		name string
+		sep  string
+		opts []Option
+	}{
+		{"default", "/", nil},
+		{"separator", ":", []Option{Separator(":")}},
+		{"cluster", "/", []Option{ClusterKeys()}},
+	}
+	for _, layout := range layouts {
+		t.Run(layout.name, func(t *testing.T) {
+			ns := func(namespace string) []Option {
+				return append([]Option{Namespace(namespace)}, layout.opts...)
+			}
+			c := new(fakeClient)
+			c.store(t, &registry.ServiceInstance{ID: "1", Name: "user"}, ns("prod")...)
+			c.store(t, &registry.ServiceInstance{ID: "2", Name: "user-admin"}, ns("prod")...)
+			c.store(t, &registry.ServiceInstance{ID: "3", Name: "user*"}, ns("prod")...)
+			c.store(t, &registry.ServiceInstance{ID: "4", Name: "users"}, ns("prod")...)
+			// namespaces nested in prod, the first one named like the service
+			c.store(t, &registry.ServiceInstance{ID: "5", Name: "user"}, ns("prod"+layout.sep+"user")...)
+			c.store(t, &registry.ServiceInstance{ID: "6", Name: "user"}, ns("prod"+layout.sep+"payments")...)
+
+			r := newTestRegistry(t, c, ns("prod")...)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			items, err := r.GetService(ctx, "user")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertIDs(t, "GetService", items, "1")
+
+			w, err := r.Watch(ctx, "user")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Stop()
+			if items, err = w.Next(); err != nil {
+				t.Fatal(err)
+			}
+			assertIDs(t, "Watch", items, "1")
+		})
+	}
+}
+
+func assertIDs(t *testing.T, op string, items []*registry.ServiceInstance, ids ...string) {
+	t.Helper()
+	got := make([]string, 0, len(items))
+	for _, si := range items {
+		got = append(got, si.ID)
+	}
+	if len(got) != len(ids) {
+		t.Fatalf("%s returned instances %q, want %q", op, got, ids)
+	}
+	for i := range ids {
+		if got[i] != ids[i] {
+			t.Fatalf("%s returned instances %q, want %q", op, got, ids)
+		}
+	}
+}
+
+// downClient is a Redis that cannot be reached.
+type downClient struct {
+	fakeClient
+}
+
+func (c *downClient) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	return redis.NewScanCmdResult(nil, 0, errors.New("dial tcp: connection refused"))
+}
+
+func TestMultiDiscoveryPartialFailure(t *testing.T) {
+	up := new(fakeClient)
+	up.store(t, &registry.ServiceInstance{ID: "1", Name: "user"}, Namespace("/microservices"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d := NewMultiDiscovery(
+		newTestRegistry(t, new(downClient), Namespace("/legacy")),
+		newTestRegistry(t, up, Namespace("/microservices")),
+	)
+	items, err := d.GetService(ctx, "user")
+	if err != nil {
+		t.Fatalf("GetService with one registry down: %v", err)
+	}
+	assertIDs(t, "GetService", items, "1")
+
+	d = NewMultiDiscovery(
+		newTestRegistry(t, new(downClient), Namespace("/legacy")),
+		newTestRegistry(t, new(downClient), Namespace("/microservices")),
+	)
+	if _, err := d.GetService(ctx, "user"); err == nil {
+		t.Fatal("GetService with every registry down succeeded")
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	record := func(id, version, heartbeat, registered string) *registry.ServiceInstance {
+		md := map[string]string{}
+		if heartbeat != "" {
+			md[MetadataLastHeartbeat] = heartbeat
+		}
+		if registered != "" {
+			md[MetadataRegisteredAt] = registered
+		}
+		return &registry.ServiceInstance{ID: id, Version: version, Metadata: md}
+	}
+	tests := []struct {
+		name  string
+		items []*registry.ServiceInstance
+		want  []string
+	}{
+		{"unique", []*registry.ServiceInstance{record("1", "a", "100", ""), record("2", "b", "100", "")}, []string{"1/a", "2/b"}},
+		{"newest heartbeat", []*registry.ServiceInstance{record("1", "old", "100", ""), record("2", "b", "100", ""), record("1", "new", "200", "")}, []string{"1/new", "2/b"}},
+		{"first kept on ties", []*registry.ServiceInstance{record("1", "first", "100", ""), record("1", "second", "100", "")}, []string{"1/first"}},
+		{"older later record", []*registry.ServiceInstance{record("1", "new", "200", ""), record("1", "old", "100", "")}, []string{"1/new"}},
+		{"registration without heartbeat", []*registry.ServiceInstance{record("1", "old", "", "100"), record("1", "new", "", "200")}, []string{"1/new"}},
+		{"timestamps over none", []*registry.ServiceInstance{record("1", "plain", "", ""), record("1", "stamped", "", "1")}, []string{"1/stamped"}},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, si := range dedupe(tt.items) {
+				got = append(got, si.ID+"/"+si.Version)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("dedupe kept %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
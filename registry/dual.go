@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+var (
+	_ registry.Registrar = (*DualRegistry)(nil)
+	_ registry.Discovery = (*DualRegistry)(nil)
+)
+
+// DualRegistry registers every instance into two independent Redis
+// deployments and discovers from the first one that answers, so the loss of a
+// whole deployment does not take service discovery down.
+type DualRegistry struct {
+	primary   *Registry
+	secondary *Registry
+}
+
+// NewDualRegistry writes to both registries and reads from primary, falling
+// back to secondary when primary fails. The registries should share their
+// namespace and key layout.
+func NewDualRegistry(primary, secondary *Registry) *DualRegistry {
+	return &DualRegistry{primary: primary, secondary: secondary}
+}
+
+// Register writes the instance to both deployments and only fails when
+// neither accepted it. An instance a deployment is unreachable for is still
+// kept alive there, and written by its heartbeats once it is back.
+func (d *DualRegistry) Register(ctx context.Context, service *registry.ServiceInstance) error {
+	errs := d.both(func(r *Registry) error { return r.Register(ctx, service) })
+	if errs[0] != nil && errs[1] != nil {
+		return errs[0]
+	}
+	registries := d.registries()
+	for i, err := range errs {
+		switch {
+		case err == nil:
+		case unreachable(err):
+			registries[i].opts.logger.Log(log.LevelWarn, "msg", "registry: dual write failed, retrying with the heartbeats", "error", err)
+			registries[i].adopt(service)
+		default:
+			// refused for good, e.g. by RegisterNX, do not leave it half registered
+			registries[1-i].deregister(ctx, service)
+			return err
+		}
+	}
+	return nil
+}
+
+// Deregister removes the instance from both deployments, and only fails when
+// neither could be reached. The heartbeats stop in both either way.
+func (d *DualRegistry) Deregister(ctx context.Context, service *registry.ServiceInstance) error {
+	errs := d.both(func(r *Registry) error { return r.Deregister(ctx, service) })
+	if errs[0] != nil && errs[1] != nil {
+		return errs[0]
+	}
+	return nil
+}
+
+// GetService reads the service from primary, or from secondary when primary
+// fails. The error of primary is returned when both fail.
+func (d *DualRegistry) GetService(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	items, err := d.primary.instances(ctx, serviceName)
+	if err == nil {
+		return items, nil
+	}
+	if items, serr := d.secondary.instances(ctx, serviceName); serr == nil {
+		return items, nil
+	}
+	return nil, err
+}
+
+func (d *DualRegistry) Watch(ctx context.Context, serviceName string) (registry.Watcher, error) {
+	return newMultiWatcher(ctx, d.GetService, serviceName, shortestWatch(d.registries())), nil
+}
+
+// Close closes both registries and returns the first error.
+func (d *DualRegistry) Close(ctx context.Context) error {
+	errs := d.both(func(r *Registry) error { return r.Close(ctx) })
+	if errs[0] != nil {
+		return errs[0]
+	}
+	return errs[1]
+}
+
+func (d *DualRegistry) registries() []*Registry {
+	return []*Registry{d.primary, d.secondary}
+}
+
+// both runs fn on both registries concurrently and returns their errors.
+func (d *DualRegistry) both(fn func(*Registry) error) [2]error {
+	var (
+		errs [2]error
+		wg   sync.WaitGroup
+	)
+	for i, r := range d.registries() {
+		wg.Add(1)
+		go func(i int, r *Registry) {
+			defer wg.Done()
+			errs[i] = fn(r)
+		}(i, r)
+	}
+	wg.Wait()
+	return errs
+}
+
+// adopt keeps the instance alive without writing it first, the heartbeats
+// write it once Redis is reachable again.
+func (r *Registry) adopt(service *registry.ServiceInstance) {
+	l := newLease(r, service)
+	r.mu.Lock()
+	if old, ok := r.leases[l.id]; ok {
+		old.stop()
+	}
+	r.leases[l.id] = l
+	r.mu.Unlock()
+	r.keepalive(l, heartbeatBackoff)
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+)
+
+// scriptClient runs the registration scripts with a fixed outcome.
+type scriptClient struct {
+	fakeClient
+
+	err error
+}
+
+func (c *scriptClient) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	return redis.NewCmdResult(int64(1), c.err)
+}
+
+func (c *scriptClient) Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd {
+	return redis.NewIntResult(0, c.err)
+}
+
+func TestDualRegisterThroughUnreachable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"deadline", context.DeadlineExceeded},
+		{"pool timeout", errors.New(poolTimeout)},
+		{"circuit open", ErrCircuitOpen},
+		{"readonly", proto("READONLY You can't write against a read only replica.")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthy, lost := new(scriptClient), &scriptClient{err: tt.err}
+			d := NewDualRegistry(newTestRegistry(t, healthy), newTestRegistry(t, lost))
+			si := &registry.ServiceInstance{ID: "1", Name: "user", Endpoints: []string{"grpc://127.0.0.1:9000"}}
+			if err := d.Register(context.Background(), si); err != nil {
+				t.Fatalf("Register: %v", err)
+			}
+			for i, r := range d.registries() {
+				if _, ok := r.leases[leaseID(si)]; !ok {
+					t.Fatalf("the instance is not kept alive by registry %d", i)
+				}
+			}
+		})
+	}
+}
+
+// proto is an error replied by Redis.
+type proto string
+
+func (e proto) Error() string { return string(e) }
+
+func (proto) RedisError() {}
@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// EventRegister is published when an instance is registered.
+	EventRegister = "register"
+	// EventDeregister is published when an instance is deregistered.
+	EventDeregister = "deregister"
+	// EventUpdate is published when the stored instance changed, e.g. when it
+	// got marked as draining or terminating.
+	EventUpdate = "update"
+)
+
+// Event is published on the namespace channel whenever the Registry
+// registers, updates or deregisters an instance.
+type Event struct {
+	Service string `json:"service"`
+	ID      string `json:"id"`
+	Action  string `json:"action"`
+}
+
+// EventChannel returns the pub/sub channel the events of the namespace are
+// published on.
+func (r *Registry) EventChannel() string {
+	return r.join(r.opts.namespace, "_events")
+}
+
+// publish is best-effort, watchers still poll when an event gets lost.
+func (r *Registry) publish(ctx context.Context, service *registry.ServiceInstance, action string) {
+	ev := &Event{
+		Service: r.join(r.opts.namespace, service.Name),
+		ID:      service.ID,
+		Action:  action,
+	}
+	r.appendEvent(ctx, service, ev)
+	if r.opts.noEvents {
+		return
+	}
+	msg, err := jsoniter.MarshalToString(ev)
+	if err != nil {
+		return
+	}
+	r.client.Publish(ctx, r.EventChannel(), msg)
+}
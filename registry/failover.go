@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-redis/redis/v8"
+)
+
+// FailoverEvent reports the master becoming unwritable during renewals, e.g.
+// while Sentinel promotes a replica, and becoming writable again.
+type FailoverEvent struct {
+	// Err is the renewal error the failover was detected by.
+	Err error
+	// Recovered is set once renewals succeed again and every instance has
+	// been rewritten to the new master.
+	Recovered bool
+	// Duration is how long renewals failed, set on recovery.
+	Duration time.Duration
+}
+
+// OnFailover is called when renewals start failing because the master went
+// read-only or unreachable, and again when they recover. While failing over,
+// renewals are retried with backoff instead of waiting for the next heartbeat,
+// and once the new master accepts writes every instance is written again.
+func OnFailover(fn func(FailoverEvent)) Option {
+	return func(o *options) { o.onFailover = fn }
+}
+
+// failingOver reports whether a renewal failed because the master is being
+// replaced: it turned into a replica, is loading, or cannot be reached.
+func failingOver(err error) bool {
+	var reply redis.Error
+	if errors.As(err, &reply) {
+		for _, prefix := range []string{"READONLY ", "LOADING ", "MASTERDOWN "} {
+			if strings.HasPrefix(reply.Error(), prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF)
+}
+
+// poolTimeout is the error of go-redis when no connection frees up in time,
+// which its pool package does not export.
+const poolTimeout = "redis: connection pool timeout"
+
+// unreachable reports whether an operation failed because Redis could not be
+// reached in time, as opposed to a reply refusing it. The breaker counts these
+// failures and DualRegistry keeps instances registered through them.
+func unreachable(err error) bool {
+	return failingOver(err) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrCircuitOpen) || err != nil && err.Error() == poolTimeout
+}
+
+// failover tracks failovers across the outcomes of a renewal pipeline. On
+// recovery, the leases not part of the pipeline are renewed right away, as
+// their keys may have been lost with the writes the old master did not
+// replicate.
+func (s *scheduler) failover(writes []*Lease, errs []error) {
+	r := s.r
+	if s.failed.IsZero() {
+		for _, err := range errs {
+			if failingOver(err) {
+				s.failed = time.Now()
+				r.opts.logger.Log(log.LevelWarn, "msg", "registry: failover detected", "error", err)
+				r.failoverEvent(FailoverEvent{Err: err})
+				return
+			}
+		}
+		return
+	}
+	for _, err := range errs {
+		if err != nil {
+			return
+		}
+	}
+
+	renewed := make(map[*Lease]bool, len(writes))
+	for _, l := range writes {
+		renewed[l] = true
+	}
+	for _, l := range r.active() {
+		if !renewed[l] && !l.isPending() {
+			s.schedule(l, 0)
+		}
+	}
+	elapsed := time.Since(s.failed)
+	s.failed = time.Time{}
+	r.opts.logger.Log(log.LevelInfo, "msg", "registry: failover recovered", "duration", elapsed)
+	r.failoverEvent(FailoverEvent{Recovered: true, Duration: elapsed})
+}
+
+func (r *Registry) failoverEvent(ev FailoverEvent) {
+	if r.opts.onFailover != nil {
+		r.opts.onFailover(ev)
+	}
+}
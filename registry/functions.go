@@ -0,0 +1,172 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-redis/redis/v8"
+)
+
+// functionLibrary names the Redis Functions library, versioned so that
+// fleets running different releases do not replace each other's functions.
+const functionLibrary = "kratos_registry_v1"
+
+// functionNames maps the scripts to the Redis Functions replacing them.
+var functionNames = map[*redis.Script]string{
+	registerScript:   functionLibrary + "_register",
+	registerNXScript: functionLibrary + "_register_nx",
+	deregisterScript: functionLibrary + "_deregister",
+
+	hashLayout.register:   functionLibrary + "_hash_register",
+	hashLayout.registerNX: functionLibrary + "_hash_register_nx",
+	hashLayout.deregister: functionLibrary + "_hash_deregister",
+
+	zsetLayout.register:   functionLibrary + "_zset_register",
+	zsetLayout.registerNX: functionLibrary + "_zset_register_nx",
+	zsetLayout.deregister: functionLibrary + "_zset_deregister",
+}
+
+// functionSource is the library registering the scripts as Redis Functions,
+// with their keys and arguments passed where the scripts expect them.
+var functionSource = "#!lua name=" + functionLibrary + "\n" +
+	libraryFunction(functionNames[registerScript], registerSource) +
+	libraryFunction(functionNames[registerNXScript], registerNXSource) +
+	libraryFunction(functionNames[deregisterScript], deregisterSource) +
+	libraryFunction(functionNames[hashLayout.register], hashRegisterSource) +
+	libraryFunction(functionNames[hashLayout.registerNX], hashRegisterNXSource) +
+	libraryFunction(functionNames[hashLayout.deregister], hashDeregisterSource) +
+	libraryFunction(functionNames[zsetLayout.register], zsetRegisterSource) +
+	libraryFunction(functionNames[zsetLayout.registerNX], zsetRegisterNXSource) +
+	libraryFunction(functionNames[zsetLayout.deregister], zsetDeregisterSource)
+
+func libraryFunction(name, source string) string {
+	return fmt.Sprintf("redis.register_function(%q, function(KEYS, ARGV)%send)\n", name, source)
+}
+
+// RedisFunctions loads the register, renew and deregister logic once as Redis
+// Functions and calls them with FCALL, instead of sending the scripts, so a
+// large fleet does not depend on every node's script cache. Servers older
+// than Redis 7 keep running the scripts.
+func RedisFunctions() Option {
+	return func(o *options) { o.functions = true }
+}
+
+const (
+	functionsUnknown = iota
+	functionsLoaded
+	functionsUnsupported
+)
+
+// functionsBackoff is the delay before loading the library again after a
+// transient failure, doubled after each one up to maxFunctionsBackoff.
+const (
+	functionsBackoff    = time.Second
+	maxFunctionsBackoff = time.Minute
+)
+
+// functions tracks whether the library is loaded on the server.
+type functions struct {
+	mu       sync.Mutex
+	state    int
+	failures int
+	retryAt  time.Time
+}
+
+// scripter is the part of clients and pipelines the scripts are run with.
+type scripter interface {
+	redis.Scripter
+	Do(ctx context.Context, args ...interface{}) *redis.Cmd
+}
+
+// run runs script with c, through FCALL when the library is loaded. Scripts
+// are sent whole in pipelines, where a missing script cannot be retried.
+func (r *Registry) run(ctx context.Context, c scripter, script *redis.Script, keys []string, args ...interface{}) *redis.Cmd {
+	_, pipelined := c.(redis.Pipeliner)
+	if name, ok := functionNames[script]; ok && r.loadFunctions(ctx) {
+		fcall := make([]interface{}, 0, 3+len(keys)+len(args))
+		fcall = append(fcall, "FCALL", name, len(keys))
+		for _, key := range keys {
+			fcall = append(fcall, key)
+		}
+		fcall = append(fcall, args...)
+		cmd := c.Do(ctx, fcall...)
+		if !pipelined && isFunctionMissing(cmd.Err()) {
+			// e.g. failed over to a node that never had it
+			r.fns.reset()
+			if r.loadFunctions(ctx) {
+				cmd = c.Do(ctx, fcall...)
+			}
+		}
+		return cmd
+	}
+	if pipelined {
+		return script.Eval(ctx, c, keys, args...)
+	}
+	return script.Run(ctx, c, keys, args...)
+}
+
+// loadFunctions loads the library on first use and reports whether FCALL can
+// be used. It is only ever attempted again after transient failures, with a
+// backoff meanwhile the scripts are run. Errors replied by the server, e.g.
+// NOPERM when ACLs deny FUNCTION, fall back to the scripts for good.
+func (r *Registry) loadFunctions(ctx context.Context) bool {
+	if !r.opts.functions {
+		return false
+	}
+	r.fns.mu.Lock()
+	defer r.fns.mu.Unlock()
+	if r.fns.state != functionsUnknown {
+		return r.fns.state == functionsLoaded
+	}
+	if time.Now().Before(r.fns.retryAt) {
+		return false
+	}
+
+	load := func(ctx context.Context, c *redis.Client) error {
+		return c.Do(ctx, "FUNCTION", "LOAD", "REPLACE", functionSource).Err()
+	}
+	var err error
+	switch c := r.client.(type) {
+	case *redis.ClusterClient:
+		err = c.ForEachMaster(ctx, load)
+	case *redis.Ring:
+		err = c.ForEachShard(ctx, load)
+	default:
+		err = r.client.Do(ctx, "FUNCTION", "LOAD", "REPLACE", functionSource).Err()
+	}
+	var reply redis.Error
+	switch {
+	case err == nil:
+		r.fns.state, r.fns.failures = functionsLoaded, 0
+	case errors.As(err, &reply) && !retryable(err):
+		r.fns.state = functionsUnsupported
+		r.opts.logger.Log(log.LevelInfo, "msg", "registry: redis functions unavailable, using scripts", "error", err)
+	default:
+		backoff := functionsBackoff << r.fns.failures
+		if backoff > maxFunctionsBackoff || backoff <= 0 {
+			backoff = maxFunctionsBackoff
+		} else {
+			r.fns.failures++
+		}
+		r.fns.retryAt = time.Now().Add(backoff)
+		r.opts.logger.Log(log.LevelWarn, "msg", "registry: loading redis functions failed", "error", err, "retry", backoff)
+	}
+	return r.fns.state == functionsLoaded
+}
+
+func (f *functions) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state, f.failures, f.retryAt = functionsUnknown, 0, time.Time{}
+}
+
+// isFunctionMissing reports an FCALL of a function the server does not have.
+func isFunctionMissing(err error) bool {
+	var reply redis.Error
+	return errors.As(err, &reply) && strings.HasPrefix(reply.Error(), "ERR Function not found")
+}
@@ -0,0 +1,190 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+)
+
+// HashLayout stores all instances of a service as the fields of a single
+// hash, "namespace/service" keyed by instance id, instead of one key per
+// instance. Discovery is then a single HGETALL and never scans the keyspace.
+// As hash fields do not expire, expired instances are skipped by discovery
+// and deleted by a janitor every TTL; the hash itself expires once no
+// instance renewed it for a TTL. It cannot be combined with Index,
+// SnapshotReads or KeyEncoder, and every Registry of the namespace must use it.
+func HashLayout() Option {
+	return func(o *options) { o.hash = true }
+}
+
+// hashLayout stores the instances of a service in a hash. The write scripts
+// take the field as ARGV[3] and the current unix milliseconds as ARGV[4], the
+// deregister script the field as ARGV[1].
+var hashLayout = layout{
+	register:   redis.NewScript(hashRegisterSource),
+	registerNX: redis.NewScript(hashRegisterNXSource),
+	deregister: redis.NewScript(hashDeregisterSource),
+}
+
+// hashExpiredSource defines expired(value, now), which reports whether a
+// stored value expired. Undecodable values never expire.
+const hashExpiredSource = `
+local function expired(value, now)
+	local ok, rec = pcall(cjson.decode, value)
+	if not ok or type(rec) ~= "table" then
+		return false
+	end
+	local expires = tonumber(rec["expiresAt"]) or 0
+	return expires > 0 and expires <= now
+end
+`
+
+// hashWriteSource defines write(), which stores the instance in its field and
+// extends the expiration of the hash to at least the TTL.
+const hashWriteSource = `
+local function write()
+	local fresh = redis.call("EXISTS", KEYS[1]) == 0
+	redis.call("HSET", KEYS[1], ARGV[3], ARGV[1])
+	local ttl = tonumber(ARGV[2])
+	if ttl > 0 then
+		local left = redis.call("PTTL", KEYS[1])
+		if fresh or (left >= 0 and left < ttl) then
+			redis.call("PEXPIRE", KEYS[1], ttl)
+		end
+	else
+		redis.call("PERSIST", KEYS[1])
+	end
+end
+`
+
+const hashRegisterSource = hashExpiredSource + hashWriteSource + `
+local current = redis.call("HGET", KEYS[1], ARGV[3])
+local existed = 0
+if current and not expired(current, tonumber(ARGV[4])) then
+	existed = 1
+end
+write()
+return existed
+`
+
+const hashRegisterNXSource = hashExpiredSource + hashWriteSource + sameInstanceSource + `
+local current = redis.call("HGET", KEYS[1], ARGV[3])
+if current and not expired(current, tonumber(ARGV[4])) and not same(current, ARGV[1]) then
+	return 0
+end
+write()
+return 1
+`
+
+const hashDeregisterSource = `
+redis.call("HDEL", KEYS[1], ARGV[1])
+return 1
+`
+
+// janitorScript deletes the expired fields of the hash KEYS[1], given the
+// current unix milliseconds ARGV[1], and returns how many it deleted. Keys of
+// other types are left alone.
+var janitorScript = redis.NewScript(hashExpiredSource + `
+if redis.call("TYPE", KEYS[1])["ok"] ~= "hash" then
+	return 0
+end
+local now = tonumber(ARGV[1])
+local fields = redis.call("HGETALL", KEYS[1])
+local gone = {}
+for i = 1, #fields, 2 do
+	if expired(fields[i + 1], now) then
+		gone[#gone + 1] = fields[i]
+	end
+end
+if #gone > 0 then
+	redis.call("HDEL", KEYS[1], unpack(gone))
+end
+return #gone
+`)
+
+// hashKey returns the key of the hash holding the instances of the service.
+func (r *Registry) hashKey(service string) string {
+	if r.opts.cluster {
+		return "{" + r.join(r.opts.namespace, r.escape(service)) + "}"
+	}
+	return r.join(r.opts.namespace, r.escape(service))
+}
+
+// hashService returns the escaped service name of a hash key, or false for
+// the other keys of the namespace.
+func (r *Registry) hashService(key string) (string, bool) {
+	prefix, suffix := r.opts.namespace+r.opts.separator, ""
+	if r.opts.cluster {
+		prefix, suffix = "{"+prefix, "}"
+	}
+	if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) {
+		return "", false
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(key, prefix), suffix)
+	// escaped names never contain the separator, streams and indexes do
+	return name, name != "" && !strings.Contains(name, r.opts.separator)
+}
+
+// hashed reads the instances stored in the hash of the service, skipping the
+// expired ones the janitor did not delete yet.
+func (r *Registry) hashed(ctx context.Context, service string) ([]*registry.ServiceInstance, error) {
+	key := r.hashKey(service)
+	fields, err := r.reader.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := millis(time.Now())
+	items := make([]*registry.ServiceInstance, 0, len(fields))
+	for id, value := range fields {
+		si, expires, err := decodeRecord(value)
+		if err != nil {
+			if err = r.malformed(key+"/"+id, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if expires > 0 && expires <= now {
+			continue
+		}
+		items = append(items, si)
+	}
+	return items, nil
+}
+
+// deregisterHash deletes the hash of the service, announcing every instance
+// it held.
+func (r *Registry) deregisterHash(ctx context.Context, service string) error {
+	key := r.hashKey(service)
+	fields, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if err := r.client.Del(ctx, key).Err(); err != nil {
+		return err
+	}
+	for _, value := range fields {
+		if si, err := decode(value); err == nil && si.Name == service {
+			r.publish(ctx, si, EventDeregister)
+		}
+	}
+	return nil
+}
+
+// sweepHashes deletes the expired instances of every hash of the namespace.
+func (r *Registry) sweepHashes(ctx context.Context) error {
+	return r.scanKeys(ctx, r.client, r.namespacePattern(), func(keys []string) error {
+		for _, key := range keys {
+			if _, ok := r.hashService(key); !ok {
+				continue
+			}
+			if err := janitorScript.Run(ctx, r.client, []string{key}, millis(time.Now())).Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
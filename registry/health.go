@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// State is the connection health of a Registry as seen by HealthCheck.
+type State int
+
+const (
+	// StateHealthy means Redis answers promptly.
+	StateHealthy State = iota
+	// StateDegraded means Redis answers slowly, or failed fewer checks in a
+	// row than it takes to be considered disconnected.
+	StateDegraded
+	// StateDisconnected means several checks in a row failed.
+	StateDisconnected
+)
+
+func (s State) String() string {
+	switch s {
+	case StateHealthy:
+		return "healthy"
+	case StateDegraded:
+		return "degraded"
+	case StateDisconnected:
+		return "disconnected"
+	}
+	return "unknown"
+}
+
+// HealthCheck PINGs Redis every interval and moves the Registry between
+// StateHealthy, StateDegraded and StateDisconnected, calling change, which may
+// be nil, on every transition. When Redis is reachable again after being
+// disconnected, every instance is written again and the watchers read their
+// service right away.
+func HealthCheck(interval time.Duration, change func(State)) Option {
+	return func(o *options) {
+		o.health = interval
+		o.onState = change
+	}
+}
+
+// State returns the connection health, always StateHealthy without HealthCheck.
+func (r *Registry) State() State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+func (r *Registry) monitor() {
+	ticker := time.NewTicker(r.opts.health)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(r.ctx, r.opts.opTimeout)
+		start := time.Now()
+		err := r.client.Ping(ctx).Err()
+		cancel()
+		if r.ctx.Err() != nil {
+			return
+		}
+
+		state := StateHealthy
+		switch {
+		case err != nil:
+			if failures++; failures >= heartbeatRetries {
+				state = StateDisconnected
+			} else {
+				state = StateDegraded
+			}
+		case time.Since(start) > r.opts.opTimeout/2:
+			failures = 0
+			state = StateDegraded
+		default:
+			failures = 0
+		}
+		r.transition(state, err)
+	}
+}
+
+// transition records the new state, recovering from a disconnection.
+func (r *Registry) transition(state State, err error) {
+	r.mu.Lock()
+	previous := r.state
+	r.state = state
+	r.mu.Unlock()
+	if state == previous {
+		return
+	}
+
+	switch {
+	case err != nil:
+		r.opts.logger.Log(log.LevelWarn, "msg", "registry: connection "+state.String(), "error", err)
+	case state > previous:
+		r.opts.logger.Log(log.LevelWarn, "msg", "registry: connection "+state.String())
+	default:
+		r.opts.logger.Log(log.LevelInfo, "msg", "registry: connection "+state.String())
+	}
+	if previous == StateDisconnected {
+		ctx, cancel := context.WithTimeout(r.ctx, r.opts.opTimeout)
+		if err := r.Refresh(ctx); err != nil {
+			r.opts.logger.Log(log.LevelError, "msg", "registry: re-registering after reconnect failed", "error", err)
+		}
+		cancel()
+		r.resync()
+	}
+	if r.opts.onState != nil {
+		r.opts.onState(state)
+	}
+}
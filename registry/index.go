@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+// Index maintains a set of instance keys per service, so that discovery reads
+// the set instead of scanning the keyspace. Every Registry writing to the
+// namespace must enable it, instances registered without it are not found. On
+// Redis Cluster it requires ClusterKeys, as the index is written in the same
+// script as the instance keys.
+func Index() Option {
+	return func(o *options) { o.index = true }
+}
+
+// indexAffixes returns what surrounds the escaped service name in index keys.
+// The sorted sets of SortedSetLayout are named apart from the sets of Index.
+func (r *Registry) indexAffixes() (prefix, suffix string) {
+	name := "_index"
+	if r.opts.zset {
+		name = "_expiry"
+	}
+	sep := r.opts.separator
+	if r.opts.cluster {
+		return "{" + r.opts.namespace + sep, "}" + sep + name
+	}
+	return r.join(r.opts.namespace, name, ""), ""
+}
+
+func (r *Registry) index(service string) string {
+	prefix, suffix := r.indexAffixes()
+	return prefix + r.escape(service) + suffix
+}
+
+// indexed reads the instances listed in the service index. Members whose key
+// expired are pruned from the index.
+func (r *Registry) indexed(ctx context.Context, service string) ([]*registry.ServiceInstance, error) {
+	index := r.index(service)
+	keys, err := r.reader.SMembers(ctx, index).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := mget(ctx, r.reader, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		items = make([]*registry.ServiceInstance, 0, len(keys))
+		stale []interface{}
+	)
+	for i, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			stale = append(stale, keys[i])
+			continue
+		}
+		si, err := decode(str)
+		if err != nil {
+			if err = r.malformed(keys[i], err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		items = append(items, si)
+	}
+	if len(stale) > 0 {
+		r.client.SRem(ctx, index, stale...)
+	}
+	return items, nil
+}
@@ -0,0 +1,36 @@
+package registry
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// InteropLayout reads and writes instances the way the kratos etcd registry
+// and the community Redis registries modelled on it do: the plain JSON of the
+// registry.ServiceInstance under "namespace/service/id", with unescaped
+// service names and ids, expiring after the TTL. Fleets mixing those
+// registries and this package discover each other as long as they share the
+// namespace, "/microservices" by default. Stored values then carry no
+// timestamps, so discovered instances lack the synthetic metadata, and
+// instances written elsewhere announce no events: watch them with polling or
+// KeyspaceWatcher. It cannot be combined with the other layouts, Index,
+// SnapshotReads, ClusterKeys or KeyEncoder.
+func InteropLayout() Option {
+	return func(o *options) { o.interop = true }
+}
+
+// encode is encode, writing the plain instance with InteropLayout.
+func (r *Registry) encode(service *registry.ServiceInstance, registered, heartbeat, expires time.Time) (string, error) {
+	if r.opts.interop {
+		return jsoniter.MarshalToString(service)
+	}
+	return encode(service, registered, heartbeat, expires)
+}
+
+// globEscape escapes the SCAN pattern characters of an unescaped key segment.
+func globEscape(segment string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(segment)
+}
@@ -0,0 +1,23 @@
+package registry
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	randMu sync.Mutex
+	rnd    = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns a random duration in [0, d*percent/100).
+func jitter(d time.Duration, percent float64) time.Duration {
+	if percent <= 0 || d <= 0 {
+		return 0
+	}
+	randMu.Lock()
+	f := rnd.Float64()
+	randMu.Unlock()
+	return time.Duration(float64(d) * percent / 100 * f)
+}
@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// keyEncoder returns the default key layout, "namespace/service/id", or the
+// "{namespace/service}/id" of ClusterKeys, joined by sep. Its pattern matches
+// the whole service segment, so that "user" does not also match the keys of
+// "user-admin".
+func keyEncoder(sep string, cluster bool) (key func(namespace, service, id string) string, pattern func(namespace, service string) string) {
+	key = func(namespace, service, id string) string {
+		return namespace + sep + service + sep + id
+	}
+	if cluster {
+		key = func(namespace, service, id string) string {
+			return "{" + namespace + sep + service + "}" + sep + id
+		}
+	}
+	pattern = func(namespace, service string) string {
+		return key(namespace, service, "*")
+	}
+	return key, pattern
+}
+
+// KeyEncoder replaces the default "namespace/service/id" key layout. pattern
+// must return a SCAN match pattern covering every key of the service and no key
+// of a service whose name merely shares its prefix. Service
+// and id segments are passed in already escaped.
+func KeyEncoder(key func(namespace, service, id string) string, pattern func(namespace, service string) string) Option {
+	return func(o *options) {
+		o.key = key
+		o.pattern = pattern
+	}
+}
+
+// ClusterKeys lays keys out as "{namespace/service}/id" for Redis Cluster and
+// redis.Ring. The hash tag puts all keys of a service, including its index, in
+// one slot or shard, so that multi-key reads and scripts of a service stay on
+// a single node. New requires it, or an equivalent KeyEncoder, on a Ring, and
+// on Redis Cluster with Index or SortedSetLayout. It cannot be combined with
+// KeyEncoder.
+func ClusterKeys() Option {
+	return func(o *options) { o.cluster = true }
+}
+
+// Separator replaces the "/" joining the namespace, service and id segments of
+// keys, e.g. with ":" to follow the convention of other Redis tools. It must
+// not contain "%" nor SCAN pattern or hash tag characters.
+func Separator(sep string) Option {
+	return func(o *options) { o.separator = sep }
+}
+
+func (o *options) validateNamespace() error {
+	sep := o.separator
+	switch {
+	case sep == "" || strings.ContainsAny(sep, patternChars+"%"):
+		return fmt.Errorf("%w: invalid separator %q", ErrInvalidConfig, sep)
+	case strings.ContainsAny(o.namespace, patternChars):
+		return fmt.Errorf("%w: invalid namespace %q", ErrInvalidConfig, o.namespace)
+	case strings.HasSuffix(o.namespace, sep) || strings.Contains(o.namespace, sep+sep):
+		return fmt.Errorf("%w: namespace %q has an empty segment", ErrInvalidConfig, o.namespace)
+	}
+	return nil
+}
+
+// patternChars are the characters SCAN patterns and hash tags give a meaning.
+const patternChars = `*?[]\{}`
+
+// join joins key segments with the separator.
+func (r *Registry) join(segments ...string) string {
+	return strings.Join(segments, r.opts.separator)
+}
+
+// namespacePattern matches the keys of every service in the namespace, and
+// those of the namespaces nested in it, which nested tells apart.
+func (r *Registry) namespacePattern() string {
+	if r.opts.cluster {
+		return "{" + r.join(r.opts.namespace, "*")
+	}
+	return r.join(r.opts.namespace, "*")
+}
+
+// nested reports whether a key matched by the patterns of the namespace
+// belongs to a namespace nested in it, e.g. "prod/payments/user/id" within
+// "prod". Below the namespace, the keys of this package hold at most one
+// separator, as escaped segments never contain it. Keys of a KeyEncoder are
+// never told apart.
+func (r *Registry) nested(key string) bool {
+	if r.opts.customKeys {
+		return false
+	}
+	rest := strings.TrimPrefix(strings.TrimPrefix(key, "{"), r.opts.namespace+r.opts.separator)
+	return strings.Count(rest, r.opts.separator) > 1
+}
+
+// escape encodes a key segment so that glob characters and the separator in
+// service names and ids can neither break SCAN patterns nor the key hierarchy.
+// Discovery decodes instances from the stored value, never from the key.
+func (r *Registry) escape(segment string) string {
+	escaped := url.PathEscape(segment)
+	if sep := r.opts.separator; sep != "/" {
+		var encoded strings.Builder
+		for i := 0; i < len(sep); i++ {
+			fmt.Fprintf(&encoded, "%%%02X", sep[i])
+		}
+		escaped = strings.ReplaceAll(escaped, sep, encoded.String())
+	}
+	return escaped
+}
+
+func (r *Registry) key(service, id string) string {
+	if r.opts.interop {
+		// other registries write the segments as they are
+		return r.opts.key(r.opts.namespace, service, id)
+	}
+	return r.opts.key(r.opts.namespace, r.escape(service), r.escape(id))
+}
+
+func (r *Registry) pattern(service string) string {
+	if r.opts.interop {
+		return r.opts.pattern(r.opts.namespace, globEscape(service))
+	}
+	return r.opts.pattern(r.opts.namespace, r.escape(service))
+}
+
+// hashTag returns the part of key Cluster and Ring hash to pick its node: the
+// content of the first non-empty {...}, else the whole key.
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// colocated returns an error unless the keys of a service that are read or
+// written together hash to the same node: an instance key and the index,
+// written by one script, and on a Ring, which reads a service from a single
+// shard, all instance keys too.
+func (r *Registry) colocated(ring bool) error {
+	if r.opts.hash {
+		// a service is a single key
+		return nil
+	}
+	const service = "service"
+	keys := []string{r.key(service, "a")}
+	if ring {
+		keys = append(keys, r.key(service, "b"))
+	}
+	if r.opts.index {
+		keys = append(keys, r.index(service))
+	}
+	for _, key := range keys[1:] {
+		if hashTag(key) != hashTag(keys[0]) {
+			return fmt.Errorf("%w: keys %q and %q of a service hash to different nodes, use ClusterKeys", ErrInvalidConfig, keys[0], key)
+		}
+	}
+	if r.opts.snapshot && !r.opts.index {
+		return fmt.Errorf("%w: snapshot reads scan a single node, use Index", ErrInvalidConfig)
+	}
+	return nil
+}
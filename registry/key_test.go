@@ -0,0 +1,139 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newTestRegistry returns a Registry without a client, for the tests that
+// only build keys and patterns or that pass a fake client.
+func newTestRegistry(t *testing.T, client redisCmd, opts ...Option) *Registry {
+	t.Helper()
+	r, err := New(client, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close(context.Background()) })
+	return r
+}
+
+// globMatch reports whether s matches the Redis glob pattern, as KEYS and
+// SCAN MATCH do: "*" and "?" match any character, separators included.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			end := strings.IndexByte(pattern[1:], ']')
+			if len(s) == 0 || end < 0 {
+				return false
+			}
+			set := pattern[1 : 1+end]
+			negate := strings.HasPrefix(set, "^")
+			if strings.ContainsRune(strings.TrimPrefix(set, "^"), rune(s[0])) == negate {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+func TestPatternMatchesOnlyItsService(t *testing.T) {
+	layouts := []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"separator", []Option{Separator(":")}},
+		{"cluster", []Option{ClusterKeys()}},
+		{"cluster separator", []Option{ClusterKeys(), Separator(":")}},
+		{"interop", []Option{InteropLayout()}},
+	}
+	tests := []struct {
+		service string
+		key     string
+		match   bool
+	}{
+		{"user", "user", true},
+		{"user", "user-admin", false},
+		{"user", "user*", false},
+		{"user", "users", false},
+		{"user*", "user*", true},
+		{"user*", "user", false},
+		{"user*", "user-admin", false},
+		{"user?", "users", false},
+		{"[user]", "[user]", true},
+		{"[user]", "u", false},
+		{"a/b", "a/b", true},
+		{"a:b", "a:b", true},
+	}
+	for _, layout := range layouts {
+		t.Run(layout.name, func(t *testing.T) {
+			r := newTestRegistry(t, nil, layout.opts...)
+			for _, tt := range tests {
+				if r.opts.interop && strings.Contains(tt.service+tt.key, r.opts.separator) {
+					// other registries do not escape the separator
+					continue
+				}
+				pattern, key := r.pattern(tt.service), r.key(tt.key, "1")
+				if got := globMatch(pattern, key); got != tt.match {
+					t.Errorf("pattern %q of %q matching key %q of %q = %v, want %v", pattern, tt.service, key, tt.key, got, tt.match)
+				}
+			}
+		})
+	}
+}
+
+func TestEscapeRoundTrip(t *testing.T) {
+	names := []string{"user", "user-admin", "user*", "a/b", "a:b", "[x]?", `a\b`, "{tag}", "100%", "ünï", "a b"}
+	for _, sep := range []string{"/", ":", "::"} {
+		r := newTestRegistry(t, nil, Separator(sep))
+		for _, name := range names {
+			escaped := r.escape(name)
+			if strings.Contains(escaped, sep) || strings.ContainsAny(escaped, patternChars) {
+				t.Errorf("separator %q: escape(%q) = %q holds a separator or pattern character", sep, name, escaped)
+			}
+			if got, err := url.PathUnescape(escaped); err != nil || got != name {
+				t.Errorf("separator %q: escape(%q) = %q unescapes to %q, %v", sep, name, escaped, got, err)
+			}
+		}
+	}
+}
+
+func TestKeyEncoderConflicts(t *testing.T) {
+	custom := KeyEncoder(
+		func(namespace, service, id string) string { return namespace + "|" + service + "|" + id },
+		func(namespace, service string) string { return namespace + "|" + service + "|*" },
+	)
+	for _, layout := range []Option{ClusterKeys(), InteropLayout(), HashLayout()} {
+		for _, opts := range [][]Option{{custom, layout}, {layout, custom}} {
+			if _, err := New(nil, opts...); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("New with KeyEncoder and another layout: got %v, want ErrInvalidConfig", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-redis/redis/v8"
+)
+
+// layout holds the scripts writing and removing instances in the way they
+// are stored. Every script takes the keys of scriptKeys, and the arguments of
+// scriptArgs for writes or of removeArgs for removals.
+type layout struct {
+	register   *redis.Script
+	registerNX *redis.Script
+	deregister *redis.Script
+}
+
+// keyLayout stores every instance under a key of its own.
+var keyLayout = layout{
+	register:   registerScript,
+	registerNX: registerNXScript,
+	deregister: deregisterScript,
+}
+
+// scriptKeys returns the keys passed to the scripts of the lease.
+func (r *Registry) scriptKeys(l *Lease) []string {
+	si := l.instance()
+	return r.instanceKeys(si.Name, si.ID)
+}
+
+// instanceKeys returns the keys passed to the scripts of an instance. The
+// register scripts add the instance key to the service index when one is
+// maintained.
+func (r *Registry) instanceKeys(service, id string) []string {
+	switch {
+	case r.opts.hash:
+		return []string{r.hashKey(service)}
+	case r.opts.index:
+		// the set of Index, or the sorted set of SortedSetLayout
+		return []string{r.key(service, id), r.index(service)}
+	}
+	return []string{r.key(service, id)}
+}
+
+// scriptArgs returns the arguments passed to the write scripts of the lease.
+func (r *Registry) scriptArgs(l *Lease, value string, expiry time.Duration) []interface{} {
+	return r.writeArgs(l.instance().ID, value, expiry)
+}
+
+// writeArgs returns the arguments passed to the write scripts of an instance.
+func (r *Registry) writeArgs(id, value string, expiry time.Duration) []interface{} {
+	args := []interface{}{value, expiry.Milliseconds()}
+	switch {
+	case r.opts.hash:
+		args = append(args, id, millis(time.Now()))
+	case r.opts.zset:
+		args = append(args, score(expiry))
+	}
+	return args
+}
+
+// removeArgs returns the arguments passed to the deregister script.
+func (r *Registry) removeArgs(id string) []interface{} {
+	if r.opts.hash {
+		return []interface{}{id}
+	}
+	return nil
+}
+
+// janitor runs sweep once per TTL, for the layouts whose entries do not expire
+// on their own.
+func (r *Registry) janitor(sweep func(ctx context.Context) error) {
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(r.opts.ttl - jitter(r.opts.ttl, r.opts.jitter)):
+		}
+
+		ctx, cancel := context.WithTimeout(r.ctx, r.opts.ttl)
+		err := sweep(ctx)
+		cancel()
+		if err != nil && r.ctx.Err() == nil {
+			r.opts.logger.Log(log.LevelWarn, "msg", "registry: deleting expired instances failed", "error", err)
+		}
+	}
+}
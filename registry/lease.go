@@ -0,0 +1,184 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+const leaseErrors = 8
+
+// ErrLeaseExpired is reported on Lease.Errors when renewals kept failing for
+// longer than the TTL, so the instance has most likely dropped out of discovery.
+var ErrLeaseExpired = errors.New("registry: lease expired")
+
+// Lease keeps a single registered instance alive.
+type Lease struct {
+	r       *Registry
+	id      string
+	key     string
+	mu      sync.Mutex
+	service *registry.ServiceInstance
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	once    sync.Once
+	errs    chan error
+	paused  bool
+	// pending until RegisterDelay or ReadySignal allow the first write
+	pending bool
+
+	// owned by the scheduler
+	gen      uint64 // guarded by the scheduler mutex
+	attempts int
+	renewed  time.Time
+
+	registered time.Time
+	heartbeat  time.Time
+	expires    time.Time
+}
+
+func leaseID(service *registry.ServiceInstance) string {
+	return service.Name + "/" + service.ID
+}
+
+func newLease(r *Registry, service *registry.ServiceInstance) *Lease {
+	now := time.Now()
+	l := &Lease{
+		r:          r,
+		id:         leaseID(service),
+		key:        r.key(service.Name, service.ID),
+		service:    service,
+		done:       make(chan struct{}),
+		errs:       make(chan error, leaseErrors),
+		renewed:    now,
+		registered: now,
+	}
+	l.ctx, l.cancel = context.WithCancel(r.ctx)
+	return l
+}
+
+// Done is closed once the lease stops renewing the registration.
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Errors reports renewals that failed after their retries. Errors are dropped
+// when nobody drains the channel.
+func (l *Lease) Errors() <-chan error {
+	return l.errs
+}
+
+// Revoke removes the instance from the registry and stops the heartbeat,
+// which keeps running during the DeregisterGrace period.
+func (l *Lease) Revoke() error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.r.deregisterTimeout())
+	defer cancel()
+	return l.r.Deregister(ctx, l.instance())
+}
+
+func (l *Lease) instance() *registry.ServiceInstance {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.service
+}
+
+// value encodes the instance for a write expiring after expiry.
+func (l *Lease) value(expiry time.Duration) (string, error) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.heartbeat, l.expires = now, time.Time{}
+	if expiry > 0 {
+		l.expires = now.Add(expiry)
+	}
+	return l.r.encode(l.r.decorate(l.service), l.registered, l.heartbeat, l.expires)
+}
+
+// update replaces the instance and encodes it with the timestamps of the last write.
+func (l *Lease) update(service *registry.ServiceInstance) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.service = service
+	return l.r.encode(l.r.decorate(l.service), l.registered, l.heartbeat, l.expires)
+}
+
+func (l *Lease) setPaused(paused bool) {
+	l.mu.Lock()
+	l.paused = paused
+	l.mu.Unlock()
+	if !paused && !l.isPending() {
+		l.r.sched.schedule(l, 0)
+	}
+}
+
+func (l *Lease) isPaused() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.paused
+}
+
+func (l *Lease) isPending() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pending
+}
+
+// delayed waits for the RegisterDelay or ReadySignal before the first write,
+// then hands the lease over to the scheduler.
+func (l *Lease) delayed() {
+	var timeout <-chan time.Time
+	if l.r.opts.delay > 0 {
+		timer := time.NewTimer(l.r.opts.delay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-l.ctx.Done():
+		return
+	case <-timeout:
+	case <-l.r.opts.ready:
+	}
+	l.mu.Lock()
+	l.pending = false
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(l.ctx, l.r.opts.opTimeout)
+	defer cancel()
+	err := l.r.write(ctx, l, l.r.opts.nx)
+	switch {
+	case errors.Is(err, ErrAlreadyRegistered):
+		l.report(err)
+		l.r.mu.Lock()
+		if l.r.leases[l.id] == l {
+			delete(l.r.leases, l.id)
+		}
+		l.r.mu.Unlock()
+		l.stop()
+	case err != nil:
+		// the next heartbeat writes the key again
+		l.report(err)
+		l.r.keepalive(l, heartbeatBackoff)
+	default:
+		l.r.registered(ctx, l.instance())
+		l.r.keepalive(l, l.r.interval())
+	}
+}
+
+func (l *Lease) report(err error) {
+	if l.r.opts.onError != nil {
+		l.r.opts.onError(err)
+	}
+	select {
+	case l.errs <- err:
+	default:
+	}
+}
+
+func (l *Lease) stop() {
+	l.cancel()
+	l.once.Do(func() { close(l.done) })
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"sort"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+const (
+	// MetadataZone is the instance metadata key holding its zone.
+	MetadataZone = "zone"
+	// MetadataRegion is the instance metadata key holding its region.
+	MetadataRegion = "region"
+)
+
+type locality struct {
+	zone   string
+	region string
+	strict bool
+}
+
+// PreferLocality returns instances in the zone first, then those in the region,
+// then all others.
+func PreferLocality(zone, region string) Option {
+	return func(o *options) { o.locality = &locality{zone: zone, region: region} }
+}
+
+// RestrictLocality only returns the instances in the zone, falling back to
+// those in the region and then to all others when there are none.
+func RestrictLocality(zone, region string) Option {
+	return func(o *options) { o.locality = &locality{zone: zone, region: region, strict: true} }
+}
+
+// rank is 0 for the same zone, 1 for the same region and 2 otherwise.
+func (l *locality) rank(si *registry.ServiceInstance) int {
+	switch {
+	case l.zone != "" && si.Metadata[MetadataZone] == l.zone:
+		return 0
+	case l.region != "" && si.Metadata[MetadataRegion] == l.region:
+		return 1
+	}
+	return 2
+}
+
+// apply reorders items by rank, keeping the order within a rank.
+func (l *locality) apply(items []*registry.ServiceInstance) []*registry.ServiceInstance {
+	sort.SliceStable(items, func(i, j int) bool {
+		return l.rank(items[i]) < l.rank(items[j])
+	})
+	if !l.strict || len(items) == 0 {
+		return items
+	}
+	best := l.rank(items[0])
+	for i, si := range items {
+		if l.rank(si) != best {
+			return items[:i]
+		}
+	}
+	return items
+}
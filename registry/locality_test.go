@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+func TestLocalityApply(t *testing.T) {
+	instance := func(id, zone, region string) *registry.ServiceInstance {
+		return &registry.ServiceInstance{ID: id, Metadata: map[string]string{MetadataZone: zone, MetadataRegion: region}}
+	}
+	instances := func() []*registry.ServiceInstance {
+		return []*registry.ServiceInstance{
+			instance("other-1", "us-1a", "us-1"),
+			instance("region-1", "eu-1b", "eu-1"),
+			instance("zone-1", "eu-1a", "eu-1"),
+			instance("other-2", "", ""),
+			instance("zone-2", "eu-1a", "eu-1"),
+			instance("region-2", "eu-1c", "eu-1"),
+		}
+	}
+	tests := []struct {
+		name     string
+		locality locality
+		items    []*registry.ServiceInstance
+		want     []string
+	}{
+		{"prefer", locality{zone: "eu-1a", region: "eu-1"}, instances(),
+			[]string{"zone-1", "zone-2", "region-1", "region-2", "other-1", "other-2"}},
+		{"prefer region only", locality{region: "eu-1"}, instances(),
+			[]string{"region-1", "zone-1", "zone-2", "region-2", "other-1", "other-2"}},
+		{"prefer unknown", locality{zone: "ap-1a", region: "ap-1"}, instances(),
+			[]string{"other-1", "region-1", "zone-1", "other-2", "zone-2", "region-2"}},
+		{"restrict to zone", locality{zone: "eu-1a", region: "eu-1", strict: true}, instances(),
+			[]string{"zone-1", "zone-2"}},
+		{"restrict falls back to region", locality{zone: "eu-1z", region: "eu-1", strict: true}, instances(),
+			[]string{"region-1", "zone-1", "zone-2", "region-2"}},
+		{"restrict falls back to all", locality{zone: "ap-1a", region: "ap-1", strict: true}, instances(),
+			[]string{"other-1", "region-1", "zone-1", "other-2", "zone-2", "region-2"}},
+		{"restrict empty", locality{zone: "eu-1a", strict: true}, nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertIDs(t, "apply", tt.locality.apply(tt.items), tt.want...)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Migrate copies every instance stored by from into the storage of to, e.g.
+// from the default layout to HashLayout or to another namespace, keeping their
+// timestamps and remaining TTL. The entries of from are left in place, so
+// readers of either layout keep finding every instance; registrars writing
+// both, through a DualRegistry, keep them in sync until every reader uses the
+// new layout and the old entries are left to expire. Instances already
+// stored by to under another value are not overwritten, so Migrate can run
+// again after an interruption.
+func Migrate(ctx context.Context, from, to *Registry) error {
+	services, err := from.ListServices(ctx)
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		if err := to.migrate(ctx, from, service); err != nil {
+			return fmt.Errorf("registry: migrating %q: %w", service, err)
+		}
+	}
+	return nil
+}
+
+// migrate writes the instances of the service read from another Registry.
+func (r *Registry) migrate(ctx context.Context, from *Registry, service string) error {
+	items, err := from.read(ctx, service)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		si, registered, heartbeat, expires := undecorate(item)
+		var expiry time.Duration
+		switch {
+		case !expires.IsZero():
+			if expiry = time.Until(expires); expiry <= 0 {
+				continue
+			}
+		case !from.opts.persistent:
+			// values without timestamps, e.g. of InteropLayout, live for a TTL
+			expiry = r.expiry(r.opts.ttl)
+		}
+		value, err := r.encode(si, registered, heartbeat, expires)
+		if err != nil {
+			return err
+		}
+		err = r.retry(ctx, OpRegister, func() error {
+			return r.run(ctx, r.client, r.layout.registerNX, r.instanceKeys(si.Name, si.ID), r.writeArgs(si.ID, value, expiry)...).Err()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
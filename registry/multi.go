@@ -0,0 +1,139 @@
+package registry
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+var (
+	_ registry.Discovery = (*MultiDiscovery)(nil)
+	_ registry.Watcher   = (*multiWatcher)(nil)
+)
+
+// MultiDiscovery reads a service from the namespaces of several registries and
+// merges the results, e.g. while migrating from "/legacy" to "/microservices".
+// When the same instance ID is found in several namespaces the registry listed
+// first wins.
+type MultiDiscovery struct {
+	registries []*Registry
+}
+
+// NewMultiDiscovery merges the discovery of the registries, in order of preference.
+func NewMultiDiscovery(registries ...*Registry) *MultiDiscovery {
+	return &MultiDiscovery{registries: registries}
+}
+
+// GetService merges the instances of the registries that could be read. A
+// registry failing is logged, and only when all of them fail is the error of
+// the first one returned.
+func (d *MultiDiscovery) GetService(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	var (
+		merged []*registry.ServiceInstance
+		seen   = make(map[string]struct{})
+		first  error
+		failed int
+	)
+	for _, r := range d.registries {
+		items, err := r.instances(ctx, serviceName)
+		if err != nil {
+			r.opts.logger.Log(log.LevelWarn, "msg", "registry: multi discovery skipped a registry", "namespace", r.opts.namespace, "error", err)
+			if failed++; first == nil {
+				first = err
+			}
+			continue
+		}
+		for _, si := range items {
+			if _, ok := seen[si.ID]; ok {
+				continue
+			}
+			seen[si.ID] = struct{}{}
+			merged = append(merged, si)
+		}
+	}
+	if failed > 0 && failed == len(d.registries) {
+		return nil, first
+	}
+	return merged, nil
+}
+
+func (d *MultiDiscovery) Watch(ctx context.Context, serviceName string) (registry.Watcher, error) {
+	return newMultiWatcher(ctx, d.GetService, serviceName, shortestWatch(d.registries)), nil
+}
+
+// shortestWatch returns the shortest watcher interval of the registries.
+func shortestWatch(registries []*Registry) time.Duration {
+	interval := defaultTTL
+	for i, r := range registries {
+		if i == 0 || r.opts.watcherTtl < interval {
+			interval = r.opts.watcherTtl
+		}
+	}
+	return interval
+}
+
+// multiWatcher polls a discovery spanning several registries at the shortest
+// watcher interval of the registries.
+type multiWatcher struct {
+	get     func(context.Context, string) ([]*registry.ServiceInstance, error)
+	service string
+	ticker  *time.Ticker
+	started bool
+	last    uint64
+	seen    bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopper
+}
+
+func newMultiWatcher(ctx context.Context, get func(context.Context, string) ([]*registry.ServiceInstance, error), service string, interval time.Duration) *multiWatcher {
+	w := &multiWatcher{
+		get:     get,
+		service: service,
+		ticker:  time.NewTicker(interval),
+		stopper: newStopper(),
+	}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	return w
+}
+
+// Next behaves like the watchers of a Registry: it returns right away on the
+// first call and then only when the instances changed.
+func (w *multiWatcher) Next() ([]*registry.ServiceInstance, error) {
+	items, err := w.next()
+	return items, w.err(err)
+}
+
+func (w *multiWatcher) next() ([]*registry.ServiceInstance, error) {
+	for {
+		if w.started {
+			select {
+			case <-w.ctx.Done():
+				return nil, w.ctx.Err()
+			case <-w.ticker.C:
+			}
+		}
+		w.started = true
+		items, err := w.get(w.ctx, w.service)
+		if err != nil {
+			return nil, err
+		}
+		sum := fingerprint(items)
+		if w.seen && sum == w.last {
+			continue
+		}
+		w.last, w.seen = sum, true
+		return items, nil
+	}
+}
+
+func (w *multiWatcher) Stop() error {
+	w.stop(func() {
+		w.ticker.Stop()
+		w.cancel()
+	})
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+// MetadataWeight is the instance metadata key holding its load balancing weight.
+const MetadataWeight = "weight"
+
+// Node is a discovered endpoint in the shape kratos selectors consume. The
+// kratos version this package builds against has no selector package, so
+// Node mirrors its fields for custom balancers.
+type Node struct {
+	Scheme      string
+	Address     string
+	ServiceName string
+	Version     string
+	Metadata    map[string]string
+	// Weight is nil unless the instance sets a valid MetadataWeight.
+	Weight *int64
+}
+
+// Nodes converts the endpoints with the scheme, e.g. "grpc", of the instances
+// into nodes, honoring the weight metadata.
+func Nodes(scheme string, instances []*registry.ServiceInstance) []*Node {
+	nodes := make([]*Node, 0, len(instances))
+	for _, si := range instances {
+		var weight *int64
+		if w, err := strconv.ParseInt(si.Metadata[MetadataWeight], 10, 64); err == nil && w >= 0 {
+			weight = &w
+		}
+		for _, e := range si.Endpoints {
+			u, err := url.Parse(e)
+			if err != nil || !strings.EqualFold(u.Scheme, scheme) {
+				continue
+			}
+			nodes = append(nodes, &Node{
+				Scheme:      u.Scheme,
+				Address:     u.Host,
+				ServiceName: si.Name,
+				Version:     si.Version,
+				Metadata:    si.Metadata,
+				Weight:      weight,
+			})
+		}
+	}
+	return nodes
+}
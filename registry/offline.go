@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/registry"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// OfflineSnapshot saves the last instances discovered of every service to the
+// file at path every interval. When the Registry starts while Redis cannot be
+// reached, discovery serves the instances saved by the previous run until it
+// reads a service from Redis, so services keep routing to their last known
+// endpoints.
+func OfflineSnapshot(path string, interval time.Duration) Option {
+	return func(o *options) {
+		o.offlinePath = path
+		o.offlineEvery = interval
+	}
+}
+
+// offlineFile is the content of the snapshot file.
+type offlineFile struct {
+	Saved    time.Time                              `json:"saved"`
+	Services map[string][]*registry.ServiceInstance `json:"services"`
+}
+
+// loadOffline reads the snapshot saved by a previous run, a missing or
+// unreadable file leaves discovery without one.
+func (r *Registry) loadOffline() {
+	data, err := os.ReadFile(r.opts.offlinePath)
+	if os.IsNotExist(err) {
+		return
+	}
+	var file offlineFile
+	if err == nil {
+		err = jsoniter.Unmarshal(data, &file)
+	}
+	if err != nil {
+		r.opts.logger.Log(log.LevelWarn, "msg", "registry: reading offline snapshot failed", "path", r.opts.offlinePath, "error", err)
+		return
+	}
+	for service, items := range file.Services {
+		r.offline.store(service, items)
+	}
+}
+
+// saveOffline writes the last discovered instances every interval and once
+// more when the Registry is closed.
+func (r *Registry) saveOffline() {
+	ticker := time.NewTicker(r.opts.offlineEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			r.writeOffline()
+			return
+		case <-ticker.C:
+			r.writeOffline()
+		}
+	}
+}
+
+func (r *Registry) writeOffline() {
+	file := offlineFile{Saved: time.Now(), Services: make(map[string][]*registry.ServiceInstance)}
+	r.stale.mu.Lock()
+	for service, s := range r.stale.snapshots {
+		file.Services[service] = s.items
+	}
+	r.stale.mu.Unlock()
+	if len(file.Services) == 0 {
+		// keep the previous snapshot while Redis has not been read yet
+		return
+	}
+
+	data, err := jsoniter.Marshal(&file)
+	if err == nil {
+		err = writeFile(r.opts.offlinePath, data)
+	}
+	if err != nil {
+		r.opts.logger.Log(log.LevelWarn, "msg", "registry: writing offline snapshot failed", "path", r.opts.offlinePath, "error", err)
+	}
+}
+
+// writeFile replaces the file at path atomically, so that a crash does not
+// leave a truncated snapshot.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
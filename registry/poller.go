@@ -0,0 +1,347 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// poller reads a service once per interval, or when notified of a change, on
+// behalf of every watcher subscribed to it, so that many watchers of the same
+// service in a process cost a single poll.
+type poller struct {
+	r        *Registry
+	key      string
+	service  string
+	interval time.Duration
+	refs     int
+	cancel   context.CancelFunc
+	resync   chan struct{}
+
+	mu        sync.Mutex
+	items     []*registry.ServiceInstance
+	err       error
+	seq       uint64
+	changed   chan struct{}
+	refreshed time.Time
+	failures  int
+	mechanism string
+	// queues of the watchers with WatchQueue
+	queues map[*queue]struct{}
+}
+
+// pollResult is a read of the service queued for a watcher.
+type pollResult struct {
+	items []*registry.ServiceInstance
+	err   error
+	seq   uint64
+}
+
+// pollResync is queued in place of the results a watcher fell behind on.
+var pollResync = &pollResult{}
+
+// subscribe returns the running poller of the service and interval, starting
+// one if needed.
+func (r *Registry) subscribe(service string, interval time.Duration) *poller {
+	key := fmt.Sprintf("%s@%s", service, interval)
+	r.pmu.Lock()
+	defer r.pmu.Unlock()
+	p, ok := r.pollers[key]
+	if !ok {
+		p = &poller{
+			r:        r,
+			key:      key,
+			service:  service,
+			interval: interval,
+			changed:  make(chan struct{}),
+			resync:   make(chan struct{}, 1),
+		}
+		var ctx context.Context
+		ctx, p.cancel = context.WithCancel(r.ctx)
+		r.pollers[key] = p
+		r.goroutine(func() { p.run(ctx) })
+	}
+	p.refs++
+	return p
+}
+
+// unsubscribe stops the poller once its last watcher stopped.
+func (r *Registry) unsubscribe(p *poller) {
+	r.pmu.Lock()
+	defer r.pmu.Unlock()
+	if p.refs--; p.refs == 0 {
+		p.cancel()
+		delete(r.pollers, p.key)
+	}
+}
+
+// resync makes every poller read its service right away.
+func (r *Registry) resync() {
+	r.pmu.Lock()
+	defer r.pmu.Unlock()
+	for _, p := range r.pollers {
+		select {
+		case p.resync <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *poller) run(ctx context.Context) {
+	timer := time.NewTimer(p.interval)
+	defer timer.Stop()
+	notify, mechanism := p.notifications(ctx)
+	p.mu.Lock()
+	p.mechanism = mechanism
+	p.mu.Unlock()
+	interval := p.interval
+	if notify != nil && p.r.opts.reconcile > 0 {
+		interval = p.r.opts.reconcile
+	}
+	failures := 0
+	for {
+		items, err := p.r.instances(ctx, p.service)
+		if ctx.Err() != nil {
+			return
+		}
+		p.publish(ctx, items, err)
+
+		// retry failed reads sooner, backing off up to the interval
+		wait := interval - jitter(interval, p.r.opts.watchJitter)
+		if err == nil {
+			failures = 0
+		} else if backoff := heartbeatBackoff << failures; backoff < wait {
+			wait = backoff
+			failures++
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-p.resync:
+		case <-notify:
+			if !p.debounce(ctx, notify) {
+				return
+			}
+		}
+	}
+}
+
+// debounce waits out the debounce window after a notification, so that a
+// burst of changes results in a single read. It returns false if ctx is done.
+func (p *poller) debounce(ctx context.Context, notify <-chan struct{}) bool {
+	window := p.r.opts.debounce
+	if window <= 0 {
+		return true
+	}
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+	}
+	// drop the notifications of the burst
+	select {
+	case <-notify:
+	default:
+	}
+	return true
+}
+
+func (p *poller) publish(ctx context.Context, items []*registry.ServiceInstance, err error) {
+	p.mu.Lock()
+	p.items, p.err = items, err
+	if err == nil {
+		p.refreshed, p.failures = time.Now(), 0
+	} else {
+		p.failures++
+	}
+	p.seq++
+	close(p.changed)
+	p.changed = make(chan struct{})
+	result := &pollResult{items: items, err: err, seq: p.seq}
+	queues := make([]*queue, 0, len(p.queues))
+	for q := range p.queues {
+		queues = append(queues, q)
+	}
+	p.mu.Unlock()
+
+	// outside the lock, OverflowBlock waits for the watchers to catch up
+	for _, q := range queues {
+		q.push(ctx, result)
+	}
+}
+
+// attach queues the results for a watcher from now on, starting with the
+// current one if the service was read already.
+func (p *poller) attach(q *queue) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.queues == nil {
+		p.queues = make(map[*queue]struct{})
+	}
+	p.queues[q] = struct{}{}
+	if p.seq > 0 {
+		q.push(context.Background(), &pollResult{items: p.items, err: p.err, seq: p.seq})
+	}
+}
+
+func (p *poller) detach(q *queue) {
+	p.mu.Lock()
+	delete(p.queues, q)
+	p.mu.Unlock()
+	q.close()
+}
+
+// next blocks until a poll newer than seq completed and returns its result
+// with its sequence number, which is 0 when ctx is done or the Registry is
+// closed first.
+func (p *poller) next(ctx context.Context, seq uint64) ([]*registry.ServiceInstance, uint64, error) {
+	for {
+		// a stopped watcher must not get the result of a poll it missed
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		if p.r.ctx.Err() != nil {
+			return nil, 0, ErrClosed
+		}
+		p.mu.Lock()
+		if p.seq > seq {
+			defer p.mu.Unlock()
+			return p.items, p.seq, p.err
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-p.r.ctx.Done():
+			return nil, 0, ErrClosed
+		case <-changed:
+		}
+	}
+}
+
+// How watchers learn about changes, as reported by WatcherStats.
+const (
+	MechanismPoll     = "poll"
+	MechanismEvents   = "events"
+	MechanismKeyspace = "keyspace"
+)
+
+// notifyMode returns the configured notification mechanism or, with
+// AdaptiveWatcher, the best one the server supports.
+func (r *Registry) notifyMode(ctx context.Context) string {
+	switch {
+	case r.opts.resync > 0:
+		return MechanismEvents
+	case r.opts.keyspace:
+		return MechanismKeyspace
+	case !r.opts.adaptive:
+		return MechanismPoll
+	}
+
+	flags, err := keyspaceEvents(ctx, r.client)
+	if err == nil {
+		all := strings.Contains(flags, "A")
+		if strings.Contains(flags, "K") && (all || strings.Contains(flags, "g") && strings.Contains(flags, "$")) {
+			return MechanismKeyspace
+		}
+	}
+	if r.opts.noEvents {
+		r.degraded(errors.New("keyspace notifications disabled and events not published, polling"))
+		return MechanismPoll
+	}
+	return MechanismEvents
+}
+
+// degraded reports a watcher falling back to a worse notification mechanism.
+func (r *Registry) degraded(err error) {
+	r.opts.logger.Log(log.LevelWarn, "msg", "registry: watcher degraded", "error", err)
+	if r.opts.onDegrade != nil {
+		r.opts.onDegrade(err)
+	}
+}
+
+// notifications returns a channel signaled when the service may have changed,
+// or nil when the poller only polls, and the mechanism in use.
+func (p *poller) notifications(ctx context.Context) (<-chan struct{}, string) {
+	var (
+		r      = p.r
+		pubsub *redis.PubSub
+		match  func(*redis.Message) bool
+	)
+	mechanism := r.notifyMode(ctx)
+	switch mechanism {
+	case MechanismEvents:
+		pubsub = r.client.Subscribe(ctx, r.EventChannel())
+		name := r.join(r.opts.namespace, p.service)
+		match = func(msg *redis.Message) bool {
+			var ev Event
+			return jsoniter.UnmarshalFromString(msg.Payload, &ev) == nil && ev.Service == name
+		}
+	case MechanismKeyspace:
+		pattern := r.pattern(p.service)
+		if r.opts.hash {
+			pattern = r.hashKey(p.service)
+		}
+		channel := fmt.Sprintf(keyspaceFormat, database(r.client), pattern)
+		pubsub = r.client.PSubscribe(ctx, channel)
+	default:
+		return nil, MechanismPoll
+	}
+	if r.opts.adaptive {
+		// wait for the subscription to be confirmed, pub/sub may be unavailable
+		if _, err := pubsub.Receive(ctx); err != nil {
+			pubsub.Close()
+			r.degraded(fmt.Errorf("subscribing failed, polling: %w", err))
+			return nil, MechanismPoll
+		}
+	}
+
+	notify := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		pubsub.Close()
+	}()
+	go func() {
+		// coalesce the messages until the poller consumes them
+		for msg := range pubsub.Channel() {
+			if match != nil && !match(msg) {
+				continue
+			}
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return notify, mechanism
+}
+
+func (p *poller) stats() WatcherStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return WatcherStats{
+		LastRefresh: p.refreshed,
+		Failures:    p.failures,
+		Mechanism:   p.mechanism,
+	}
+}
@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"context"
+	"sync"
+)
+
+// Overflow decides what a bounded queue does when a slow consumer let it fill
+// up, see WatchQueue and Subscribe.
+type Overflow int
+
+const (
+	// OverflowCoalesce replaces the queued values with a single marker telling
+	// the consumer to re-read the current state.
+	OverflowCoalesce Overflow = iota
+	// OverflowDropOldest discards the oldest queued value.
+	OverflowDropOldest
+	// OverflowBlock makes the producer wait until the consumer catches up.
+	OverflowBlock
+)
+
+// queue is a bounded FIFO between one producer and one consumer.
+type queue struct {
+	size     int
+	overflow Overflow
+	// resync is the marker OverflowCoalesce replaces the values with
+	resync interface{}
+
+	mu      sync.Mutex
+	items   []interface{}
+	changed chan struct{}
+	closed  bool
+}
+
+func newQueue(size int, overflow Overflow, resync interface{}) *queue {
+	if size < 1 {
+		size = 1
+	}
+	return &queue{size: size, overflow: overflow, resync: resync, changed: make(chan struct{})}
+}
+
+// signal wakes the goroutines waiting for a change, q.mu must be held.
+func (q *queue) signal() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// push appends v, applying the overflow policy when the queue is full. With
+// OverflowBlock it waits until there is room, ctx is done or q is closed.
+func (q *queue) push(ctx context.Context, v interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) >= q.size && !q.closed {
+		switch q.overflow {
+		case OverflowBlock:
+			changed := q.changed
+			q.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				q.mu.Lock()
+				return
+			case <-changed:
+			}
+			q.mu.Lock()
+			continue
+		case OverflowDropOldest:
+			q.items = q.items[1:]
+		default:
+			q.items = append(q.items[:0], q.resync)
+			q.signal()
+			return
+		}
+	}
+	if q.closed {
+		return
+	}
+	if n := len(q.items); n > 0 && q.overflow == OverflowCoalesce && q.items[n-1] == q.resync {
+		// the consumer re-reads the current state anyway
+		return
+	}
+	q.items = append(q.items, v)
+	q.signal()
+}
+
+// pop blocks until a value is queued and returns it. It returns ctx.Err()
+// once ctx is done and ErrClosed once q is closed and drained.
+func (q *queue) pop(ctx context.Context) (interface{}, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			v := q.items[0]
+			q.items[0] = nil
+			q.items = q.items[1:]
+			q.signal()
+			q.mu.Unlock()
+			return v, nil
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrClosed
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// close unblocks the producer and, once drained, the consumer.
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		q.signal()
+	}
+}
@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const resyncMarker = "resync"
+
+// drain pops every queued value of a closed queue.
+func drain(t *testing.T, q *queue) []interface{} {
+	t.Helper()
+	q.close()
+	var got []interface{}
+	for {
+		v, err := q.pop(context.Background())
+		if errors.Is(err, ErrClosed) {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		overflow Overflow
+		push     []interface{}
+		want     []interface{}
+	}{
+		{"coalesce within size", 3, OverflowCoalesce, []interface{}{1, 2}, []interface{}{1, 2}},
+		{"coalesce full", 2, OverflowCoalesce, []interface{}{1, 2, 3}, []interface{}{resyncMarker}},
+		{"coalesce after resync", 2, OverflowCoalesce, []interface{}{1, 2, 3, 4, 5}, []interface{}{resyncMarker}},
+		{"drop oldest within size", 3, OverflowDropOldest, []interface{}{1, 2}, []interface{}{1, 2}},
+		{"drop oldest full", 2, OverflowDropOldest, []interface{}{1, 2, 3, 4}, []interface{}{3, 4}},
+		{"size defaults to 1", 0, OverflowDropOldest, []interface{}{1, 2}, []interface{}{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newQueue(tt.size, tt.overflow, resyncMarker)
+			for _, v := range tt.push {
+				q.push(context.Background(), v)
+			}
+			if got := drain(t, q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueOverflowBlock(t *testing.T) {
+	q := newQueue(1, OverflowBlock, resyncMarker)
+	q.push(context.Background(), 1)
+	pushed := make(chan struct{})
+	go func() {
+		q.push(context.Background(), 2)
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push did not wait for room")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if v, err := q.pop(context.Background()); err != nil || v != 1 {
+		t.Fatalf("pop = %v, %v, want 1", v, err)
+	}
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("push still blocked after a pop")
+	}
+	if got := drain(t, q); !reflect.DeepEqual(got, []interface{}{2}) {
+		t.Errorf("queued %v, want [2]", got)
+	}
+
+	// a blocked push gives up with its context
+	q = newQueue(1, OverflowBlock, resyncMarker)
+	q.push(context.Background(), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	q.push(ctx, 2)
+	if got := drain(t, q); !reflect.DeepEqual(got, []interface{}{1}) {
+		t.Errorf("queued %v, want [1]", got)
+	}
+}
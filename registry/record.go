@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Synthetic metadata keys filled in on discovered instances from the
+// timestamps stored next to them, as unix milliseconds. MetadataTTLRemaining
+// holds the milliseconds left until the expiration when the instance was read.
+const (
+	MetadataRegisteredAt  = "__registered_at"
+	MetadataLastHeartbeat = "__last_heartbeat"
+	MetadataExpiresAt     = "__expires_at"
+	MetadataTTLRemaining  = "__ttl_remaining"
+)
+
+// syntheticMetadata holds the metadata keys filled in by decode.
+var syntheticMetadata = map[string]bool{
+	MetadataRegisteredAt:  true,
+	MetadataLastHeartbeat: true,
+	MetadataExpiresAt:     true,
+	MetadataTTLRemaining:  true,
+}
+
+// schemaVersion is the version of the record format written by this package.
+// Values written before versioning have none and decode as version 0. Values
+// of a later version are rejected like malformed ones, so readers must be
+// upgraded before writers.
+const schemaVersion = 1
+
+// record is the stored value, the instance extended with its timestamps in
+// unix milliseconds and the version of its format. Readers unaware of the
+// extra fields still decode the instance.
+type record struct {
+	*registry.ServiceInstance
+	Schema        int   `json:"schema,omitempty"`
+	RegisteredAt  int64 `json:"registeredAt,omitempty"`
+	LastHeartbeat int64 `json:"lastHeartbeat,omitempty"`
+	ExpiresAt     int64 `json:"expiresAt,omitempty"`
+}
+
+func encode(service *registry.ServiceInstance, registered, heartbeat, expires time.Time) (string, error) {
+	return jsoniter.MarshalToString(&record{
+		ServiceInstance: service,
+		Schema:          schemaVersion,
+		RegisteredAt:    millis(registered),
+		LastHeartbeat:   millis(heartbeat),
+		ExpiresAt:       millis(expires),
+	})
+}
+
+// decode reads a stored value, exposing its timestamps as synthetic metadata.
+func decode(value string) (*registry.ServiceInstance, error) {
+	si, _, err := decodeRecord(value)
+	return si, err
+}
+
+// decodeRecord is decode also returning the expiration in unix milliseconds,
+// 0 for none.
+func decodeRecord(value string) (*registry.ServiceInstance, int64, error) {
+	rec := record{ServiceInstance: new(registry.ServiceInstance)}
+	if err := jsoniter.UnmarshalFromString(value, &rec); err != nil {
+		return nil, 0, err
+	}
+	if rec.Schema > schemaVersion {
+		return nil, 0, fmt.Errorf("record schema %d is newer than %d", rec.Schema, schemaVersion)
+	}
+	si := rec.ServiceInstance
+	synthetic := map[string]int64{
+		MetadataRegisteredAt:  rec.RegisteredAt,
+		MetadataLastHeartbeat: rec.LastHeartbeat,
+		MetadataExpiresAt:     rec.ExpiresAt,
+	}
+	if rec.ExpiresAt != 0 {
+		remaining := rec.ExpiresAt - millis(time.Now())
+		if remaining < 1 {
+			remaining = 1
+		}
+		synthetic[MetadataTTLRemaining] = remaining
+	}
+	for k, v := range synthetic {
+		if v == 0 {
+			continue
+		}
+		if si.Metadata == nil {
+			si.Metadata = make(map[string]string, len(synthetic))
+		}
+		si.Metadata[k] = strconv.FormatInt(v, 10)
+	}
+	return si, rec.ExpiresAt, nil
+}
+
+// undecorate reverses decode: it returns a copy of a discovered instance
+// without the synthetic metadata, and the timestamps it held.
+func undecorate(service *registry.ServiceInstance) (si *registry.ServiceInstance, registered, heartbeat, expires time.Time) {
+	stamps := map[string]*time.Time{
+		MetadataRegisteredAt:  &registered,
+		MetadataLastHeartbeat: &heartbeat,
+		MetadataExpiresAt:     &expires,
+	}
+	copied := *service
+	copied.Metadata = make(map[string]string, len(service.Metadata))
+	for k, v := range service.Metadata {
+		if t, ok := stamps[k]; ok {
+			if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+				*t = time.Unix(0, ms*int64(time.Millisecond))
+			}
+			continue
+		}
+		if k != MetadataTTLRemaining {
+			copied.Metadata[k] = v
+		}
+	}
+	if len(copied.Metadata) == 0 {
+		copied.Metadata = nil
+	}
+	return &copied, registered, heartbeat, expires
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
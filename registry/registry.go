@@ -2,12 +2,15 @@ package registry
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/registry"
 	"github.com/go-redis/redis/v8"
-	jsoniter "github.com/json-iterator/go"
 )
 
 var (
@@ -15,11 +18,32 @@ var (
 	_ registry.Discovery = (*Registry)(nil)
 )
 
+var (
+	// ErrClosed is returned when registering on a closed Registry.
+	ErrClosed = errors.New("registry: closed")
+	// ErrInvalidConfig is wrapped by the errors New returns for invalid options.
+	ErrInvalidConfig = errors.New("registry: invalid config")
+	// ErrPanic wraps panics recovered from the heartbeat loops.
+	ErrPanic = errors.New("registry: panic")
+	// ErrAlreadyRegistered is returned by RegisterNX registries when another
+	// payload is stored under the same service name and id.
+	ErrAlreadyRegistered = errors.New("registry: instance already registered")
+	// ErrNotRegistered is returned when updating an instance this Registry does not keep alive.
+	ErrNotRegistered = errors.New("registry: instance not registered")
+	// ErrServiceNotFound can be returned by clients when HasService reports false.
+	ErrServiceNotFound = errors.New("registry: service not registered")
+	// ErrMalformed wraps the errors of entries discovery cannot decode.
+	ErrMalformed = errors.New("registry: malformed instance")
+	// ErrWatcherStopped is returned by the Next of a stopped watcher.
+	ErrWatcherStopped = errors.New("registry: watcher stopped")
+)
+
 const (
-	keyFormat     = "%s/%s/%s"
-	watcherFormat = "%s/%s"
-	defaultScan   = 20
-	defaultTTL    = time.Minute
+	defaultScan      = 20
+	defaultTTL       = time.Minute
+	defaultOpTimeout = 3 * time.Second
+	heartbeatRetries = 3
+	heartbeatBackoff = 100 * time.Millisecond
 )
 
 type (
@@ -30,14 +54,94 @@ type (
 		namespace  string
 		ttl        time.Duration
 		watcherTtl time.Duration
+		opTimeout  time.Duration
+		heartbeat  time.Duration
+		onError    func(error)
+		jitter     float64
+		onRestore  func(*registry.ServiceInstance)
+		noEvents   bool
+		nx         bool
+		autoDereg  bool
+		filters    []func(*registry.ServiceInstance) bool
+		delay      time.Duration
+		ready      <-chan struct{}
+		logger     log.Logger
+		decorators []func(*registry.ServiceInstance) *registry.ServiceInstance
+		persistent bool
+		retry      map[Operation]RetryPolicy
+		grace      time.Duration
+		index      bool
+		invalid    error
+		less       func(a, b *registry.ServiceInstance) bool
+		locality   *locality
+		minTTL     time.Duration
+		maxStale   time.Duration
+		snapshot   bool
+		keyspace   bool
+		resync     time.Duration
+		streamLen  int64
+		queueSize  int
+		overflow   Overflow
+
+		watchFailures int
+		onWatchError  func(error)
+		watchJitter   float64
+		adaptive      bool
+		onDegrade     func(error)
+		reconcile     time.Duration
+		debounce      time.Duration
+		detach        bool
+		cluster       bool
+		reader        redisCmd
+		tls           *tls.Config
+		credentials   CredentialsProvider
+		health        time.Duration
+		hash          bool
+		zset          bool
+		interop       bool
+		functions     bool
+
+		offlinePath     string
+		offlineEvery    time.Duration
+		breakerFailures int
+		breakerCooldown time.Duration
+		onState         func(State)
+
+		separator  string
+		key        func(namespace, service, id string) string
+		pattern    func(namespace, service string) string
+		customKeys bool
+
+		beforeRegister  []func(context.Context, *registry.ServiceInstance) error
+		afterRegister   []func(context.Context, *registry.ServiceInstance)
+		afterDeregister []func(context.Context, *registry.ServiceInstance)
+		onMalformed     func(key string, err error)
+		onFailover      func(FailoverEvent)
 	}
 
 	Registry struct {
 		opts   *options
-		client *redis.Client
-		ticker *time.Ticker
-		cancel context.CancelFunc
-		ctx    context.Context
+		client redisCmd
+		// reader serves discovery, it is client unless ReadClient is set
+		reader  redisCmd
+		cancel  context.CancelFunc
+		ctx     context.Context
+		mu      sync.Mutex
+		leases  map[string]*Lease
+		state   State
+		fns     functions
+		layout  layout
+		breaker breaker
+		sched   *scheduler
+		wg      sync.WaitGroup
+		stale   staleCache
+		// instances saved by the previous run, see OfflineSnapshot
+		offline staleCache
+
+		pmu     sync.Mutex
+		pollers map[string]*poller
+		// owned clients are closed by Close
+		owned bool
 	}
 )
 
@@ -45,6 +149,9 @@ func Context(ctx context.Context) Option {
 	return func(o *options) { o.ctx = ctx }
 }
 
+// Namespace prefixes every key, "/microservices" by default. It may hold
+// several segments joined by the separator, e.g. "prod/payments/asia", and
+// the registries of a namespace never see those of the namespaces nested in it.
 func Namespace(ns string) Option {
 	return func(o *options) { o.namespace = ns }
 }
@@ -56,118 +163,737 @@ func WatcherTTL(ttl time.Duration) Option {
 	return func(o *options) { o.watcherTtl = ttl }
 }
 
-func New(client *redis.Client, opts ...Option) *Registry {
+// HeartbeatInterval sets how often registrations are renewed, defaults to a third of the TTL.
+func HeartbeatInterval(interval time.Duration) Option {
+	return func(o *options) { o.heartbeat = interval }
+}
+
+// OnHeartbeatError is called when a renewal still fails after its retries.
+func OnHeartbeatError(fn func(error)) Option {
+	return func(o *options) { o.onError = fn }
+}
+
+// Jitter randomizes the TTL padding and the heartbeat interval by up to percent
+// of the TTL and interval, spreading renewals of fleets started together.
+func Jitter(percent float64) Option {
+	return func(o *options) { o.jitter = percent }
+}
+
+// OnReregister is called when a heartbeat finds the key gone, e.g. after a
+// Redis restart or failover, and had to write the instance again.
+func OnReregister(fn func(*registry.ServiceInstance)) Option {
+	return func(o *options) { o.onRestore = fn }
+}
+
+// DisableEvents stops publishing register and deregister events.
+func DisableEvents() Option {
+	return func(o *options) { o.noEvents = true }
+}
+
+// BeforeRegister adds a hook that runs before an instance is written. It may
+// mutate the instance, or veto the registration by returning an error.
+func BeforeRegister(fn func(context.Context, *registry.ServiceInstance) error) Option {
+	return func(o *options) { o.beforeRegister = append(o.beforeRegister, fn) }
+}
+
+// AfterRegister adds a hook that runs after an instance has been registered.
+func AfterRegister(fn func(context.Context, *registry.ServiceInstance)) Option {
+	return func(o *options) { o.afterRegister = append(o.afterRegister, fn) }
+}
+
+// AfterDeregister adds a hook that runs after an instance has been deregistered.
+func AfterDeregister(fn func(context.Context, *registry.ServiceInstance)) Option {
+	return func(o *options) { o.afterDeregister = append(o.afterDeregister, fn) }
+}
+
+// RegisterNX refuses to overwrite a different instance stored under the same
+// service name and id, Register returns ErrAlreadyRegistered instead.
+func RegisterNX() Option {
+	return func(o *options) { o.nx = true }
+}
+
+// AutoDeregister removes every instance registered by the Registry once the
+// context passed with Context is done or the Registry is closed.
+func AutoDeregister() Option {
+	return func(o *options) { o.autoDereg = true }
+}
+
+// RegisterDelay makes Register return right away and write the instance only
+// once the delay has elapsed, so slow starting services get time to warm up.
+func RegisterDelay(d time.Duration) Option {
+	return func(o *options) { o.delay = d }
+}
+
+// ReadySignal makes Register return right away and write the instance once
+// ready is closed, or the RegisterDelay elapsed, whichever comes first.
+func ReadySignal(ready <-chan struct{}) Option {
+	return func(o *options) { o.ready = ready }
+}
+
+// Logger sets the logger background failures are logged with.
+func Logger(logger log.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// InstanceDecorator transforms every instance right before it is marshaled,
+// e.g. to fill in host details or strip sensitive metadata. The instance passed
+// to Register is not modified as long as fn returns a copy.
+func InstanceDecorator(fn func(*registry.ServiceInstance) *registry.ServiceInstance) Option {
+	return func(o *options) { o.decorators = append(o.decorators, fn) }
+}
+
+// Persistent writes instances without expiration and without heartbeats, for
+// deployments relying on an external reaper. Deregister is the only way an
+// instance gets removed.
+func Persistent() Option {
+	return func(o *options) { o.persistent = true }
+}
+
+// RegisterRetry retries the initial write of an instance up to max times,
+// doubling backoff after each attempt, so a briefly unreachable Redis does not
+// abort the service startup.
+func RegisterRetry(max int, backoff time.Duration) Option {
+	return Retry(OpRegister, RetryPolicy{MaxAttempts: max + 1, Backoff: backoff})
+}
+
+// DeregisterGrace makes Deregister mark the instance as terminating first and
+// keep it alive for the grace period, so load balancers can drain connections
+// before the instance disappears.
+func DeregisterGrace(grace time.Duration) Option {
+	return func(o *options) { o.grace = grace }
+}
+
+// ReadClient serves discovery and watchers from client, e.g. a replica or
+// the nearest node, while registrations and heartbeats keep going to the
+// client passed to New. Replication lag delays the instances seen by readers,
+// and the client is not closed by Close.
+func ReadClient(client redisCmd) Option {
+	return func(o *options) { o.reader = client }
+}
+
+// OpTimeout bounds every background heartbeat renewal.
+func OpTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.opTimeout = timeout }
+}
+
+// New creates a Registry on any redis.UniversalClient: a *redis.Client, a
+// Sentinel failover client, a *redis.ClusterClient or a *redis.Ring with
+// ClusterKeys, or on a wrapper of one implementing the commands the Registry
+// issues.
+func New(client redisCmd, opts ...Option) (*Registry, error) {
 	options := &options{
 		ctx:        context.Background(),
 		namespace:  "/microservices",
 		ttl:        defaultTTL,
 		watcherTtl: defaultTTL,
+		opTimeout:  defaultOpTimeout,
+		separator:  "/",
+		less:       byID,
+		logger:     log.DefaultLogger,
 	}
 	for _, o := range opts {
 		o(options)
 	}
+	if options.heartbeat <= 0 {
+		options.heartbeat = options.ttl / 3
+	}
+	options.customKeys = options.key != nil
+	if !options.customKeys {
+		options.key, options.pattern = keyEncoder(options.separator, options.cluster)
+	}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
 	r := &Registry{
-		client: client,
-		opts:   options,
-		ticker: time.NewTicker(options.ttl),
+		client:  client,
+		reader:  client,
+		opts:    options,
+		leases:  make(map[string]*Lease),
+		pollers: make(map[string]*poller),
 	}
 
+	if options.reader != nil {
+		r.reader = options.reader
+	}
+	switch client.(type) {
+	case *redis.Ring:
+		if err := r.colocated(true); err != nil {
+			return nil, err
+		}
+	case *redis.ClusterClient:
+		if err := r.colocated(false); err != nil {
+			return nil, err
+		}
+	}
+	r.breaker.r = r
+	switch {
+	case options.hash:
+		r.layout = hashLayout
+	case options.zset:
+		r.layout = zsetLayout
+	default:
+		r.layout = keyLayout
+	}
 	r.ctx, r.cancel = context.WithCancel(options.ctx)
-	return r
+	r.sched = newScheduler(r)
+	r.goroutine(r.sched.run)
+	if options.offlinePath != "" {
+		r.loadOffline()
+		r.goroutine(r.saveOffline)
+	}
+	if options.health > 0 {
+		r.goroutine(r.monitor)
+	}
+	switch {
+	case options.hash:
+		r.goroutine(func() { r.janitor(r.sweepHashes) })
+	case options.zset:
+		r.goroutine(func() { r.janitor(r.sweepScores) })
+	}
+	if options.autoDereg {
+		r.goroutine(func() {
+			<-r.ctx.Done()
+			if options.ctx.Err() != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), r.deregisterTimeout())
+				defer cancel()
+				r.deregisterAll(ctx)
+			}
+		})
+	}
+	return r, nil
+}
+
+func (o *options) validate() error {
+	switch {
+	case o.invalid != nil:
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, o.invalid)
+	case o.ttl < time.Second:
+		return fmt.Errorf("%w: ttl %s is shorter than 1s", ErrInvalidConfig, o.ttl)
+	case o.heartbeat >= o.ttl:
+		return fmt.Errorf("%w: ttl %s is not longer than the heartbeat interval %s", ErrInvalidConfig, o.ttl, o.heartbeat)
+	case o.watcherTtl <= 0:
+		return fmt.Errorf("%w: watcher ttl %s is not positive", ErrInvalidConfig, o.watcherTtl)
+	case o.opTimeout <= 0:
+		return fmt.Errorf("%w: operation timeout %s is not positive", ErrInvalidConfig, o.opTimeout)
+	case o.jitter < 0 || o.jitter >= 100:
+		return fmt.Errorf("%w: jitter %v is not in [0, 100)", ErrInvalidConfig, o.jitter)
+	case o.watchJitter < 0 || o.watchJitter >= 100:
+		return fmt.Errorf("%w: watcher jitter %v is not in [0, 100)", ErrInvalidConfig, o.watchJitter)
+	case o.queueSize < 0:
+		return fmt.Errorf("%w: negative watch queue size", ErrInvalidConfig)
+	case o.watchFailures < 0:
+		return fmt.Errorf("%w: negative watcher failures", ErrInvalidConfig)
+	case o.breakerFailures < 0 || o.breakerCooldown < 0:
+		return fmt.Errorf("%w: negative circuit breaker setting", ErrInvalidConfig)
+	case o.offlinePath != "" && o.offlineEvery <= 0:
+		return fmt.Errorf("%w: offline snapshot interval %s is not positive", ErrInvalidConfig, o.offlineEvery)
+	case o.zset && (o.hash || o.snapshot):
+		return fmt.Errorf("%w: the sorted set layout is read without hash and snapshot", ErrInvalidConfig)
+	case o.hash && (o.index || o.snapshot):
+		return fmt.Errorf("%w: the hash layout is read without index and snapshot", ErrInvalidConfig)
+	case o.hash && o.customKeys:
+		return fmt.Errorf("%w: the hash layout does not use KeyEncoder", ErrInvalidConfig)
+	case o.customKeys && (o.cluster || o.interop):
+		return fmt.Errorf("%w: ClusterKeys and InteropLayout replace KeyEncoder", ErrInvalidConfig)
+	case o.interop && (o.hash || o.zset || o.index || o.snapshot || o.cluster):
+		return fmt.Errorf("%w: the interop layout is read without other layouts, index, snapshot and cluster keys", ErrInvalidConfig)
+	case o.health < 0:
+		return fmt.Errorf("%w: health check interval %s is negative", ErrInvalidConfig, o.health)
+	}
+	if err := o.validateNamespace(); err != nil {
+		return err
+	}
+	return o.validateRetry()
 }
 
 func (r *Registry) GetService(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
-	return services(ctx, r.client, serviceName)
+	return r.instances(ctx, serviceName)
 }
 
 func (r *Registry) Watch(ctx context.Context, serviceName string) (registry.Watcher, error) {
-	key := fmt.Sprintf(watcherFormat, r.opts.namespace, serviceName)
-	return newWatcher(ctx, key, r.client, r.opts.watcherTtl), nil
+	return newWatcher(ctx, r, serviceName)
 }
 
-func (r *Registry) Register(ctx context.Context, service *registry.ServiceInstance) error {
-	key := fmt.Sprintf(keyFormat, r.opts.namespace, service.Name, service.ID)
-	value, err := jsoniter.MarshalToString(service)
+// WatchWith is Watch with per-watcher options, e.g. to poll faster than the
+// other watchers of the Registry.
+func (r *Registry) WatchWith(ctx context.Context, serviceName string, opts ...WatchOption) (registry.Watcher, error) {
+	w, err := newWatcher(ctx, r, serviceName, opts...)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return w, nil
+}
+
+func (r *Registry) Register(ctx context.Context, service *registry.ServiceInstance) error {
+	_, err := r.RegisterLease(ctx, service)
+	return err
+}
 
-	if err := r.register(ctx, key, value, r.opts.ttl); err != nil {
+// RegisterLease registers the instance like Register and returns the Lease
+// that keeps it alive. Registering an instance again returns its existing
+// Lease after rewriting the stored value.
+func (r *Registry) RegisterLease(ctx context.Context, service *registry.ServiceInstance) (*Lease, error) {
+	if r.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+	if err := r.prepare(ctx, service); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	current, ok := r.leases[leaseID(service)]
+	r.mu.Unlock()
+	if ok && current.ctx.Err() == nil {
+		// already kept alive, only the stored value may need to change
+		if err := r.Update(ctx, service); err != nil {
+			return nil, err
+		}
+		return current, nil
+	}
+
+	l := newLease(r, service)
+	delayed := r.opts.delay > 0 || r.opts.ready != nil
+	l.pending = delayed
+	if !delayed {
+		if err := r.write(ctx, l, r.opts.nx); err != nil {
+			return nil, err
+		}
+	}
+
+	r.track(l)
+	if delayed {
+		r.goroutine(l.delayed)
+		return l, nil
+	}
+	r.keepalive(l, r.interval())
+	r.registered(ctx, service)
+	return l, nil
+}
+
+// keepalive hands the lease to the scheduler, persistent leases are never renewed.
+func (r *Registry) keepalive(l *Lease, after time.Duration) {
+	if !r.opts.persistent {
+		r.sched.schedule(l, after)
+	}
+}
+
+// prepare runs the register hooks and validation.
+func (r *Registry) prepare(ctx context.Context, service *registry.ServiceInstance) error {
+	for _, fn := range r.opts.beforeRegister {
+		if err := fn(ctx, service); err != nil {
+			return err
+		}
+	}
+	return r.validate(service)
+}
+
+// write performs the initial write of a lease, retried as configured with
+// the OpRegister RetryPolicy.
+func (r *Registry) write(ctx context.Context, l *Lease, nx bool) error {
+	if err := r.breaker.allow(); err != nil {
 		return err
 	}
+	return r.retry(ctx, OpRegister, func() error {
+		var err error
+		if nx {
+			err = r.registerNX(ctx, l)
+		} else {
+			_, err = r.register(ctx, l)
+		}
+		r.breaker.record(err)
+		return err
+	})
+}
 
-	go func() {
-		for {
-			select {
-			case <-r.ctx.Done():
-				return
-			case _, ok := <-r.ticker.C:
-				if !ok {
-					return
-				}
-				r.register(ctx, key, value, r.opts.ttl)
-			}
+// protect runs a background loop, turning a panic into an error that is
+// logged and passed to report. It reports whether fn panicked.
+func (r *Registry) protect(fn func(), report func(error)) (panicked bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			err := fmt.Errorf("%w: %v", ErrPanic, v)
+			r.opts.logger.Log(log.LevelError, "msg", "registry: background loop panicked, restarting", "error", err)
+			report(err)
+			panicked = true
 		}
 	}()
+	fn()
+	return false
+}
 
-	return nil
+func (r *Registry) decorate(service *registry.ServiceInstance) *registry.ServiceInstance {
+	for _, fn := range r.opts.decorators {
+		service = fn(service)
+	}
+	return service
 }
 
-func (r *Registry) register(ctx context.Context, key string, value string, ttl time.Duration) error {
-	res, err := r.client.TTL(ctx, key).Result()
-	if err != nil {
+// restored reports an instance a heartbeat had to write again.
+func (r *Registry) restored(service *registry.ServiceInstance) {
+	if r.opts.onRestore != nil {
+		r.opts.onRestore(service)
+	}
+}
+
+// interval returns the delay until the next renewal of a lease.
+func (r *Registry) interval() time.Duration {
+	return r.opts.heartbeat - jitter(r.opts.heartbeat, r.opts.jitter)
+}
+
+// registered announces an instance once its key has been written.
+func (r *Registry) registered(ctx context.Context, service *registry.ServiceInstance) {
+	r.publish(ctx, service, EventRegister)
+	for _, fn := range r.opts.afterRegister {
+		fn(ctx, service)
+	}
+}
+
+// Update rewrites the stored value of an instance registered by this Registry,
+// keeping its current TTL, so metadata changes take effect without re-registering.
+func (r *Registry) Update(ctx context.Context, service *registry.ServiceInstance) error {
+	if err := r.validate(service); err != nil {
 		return err
 	}
+	r.mu.Lock()
+	l, ok := r.leases[leaseID(service)]
+	r.mu.Unlock()
+	if !ok {
+		return ErrNotRegistered
+	}
 
-	ttl = ttl + 2*time.Second
-	if res > 1 {
-		err := r.client.Expire(ctx, key, ttl).Err()
+	value, err := l.update(service)
+	if err != nil || l.isPending() {
+		// a pending instance is written with its update once ready
+		return err
+	}
+	err = r.breaker.guarded(func() error {
+		if r.opts.hash {
+			// fields have no TTL to keep, the value carries the expiry
+			_, err := r.register(ctx, l)
+			return err
+		}
+		ok, err := r.client.SetXX(ctx, l.key, value, redis.KeepTTL).Result()
+		if err == nil && !ok {
+			_, err = r.register(ctx, l)
+		}
 		return err
+	})
+	if err == nil {
+		r.publish(ctx, service, EventUpdate)
 	}
-	return r.client.Set(ctx, key, value, ttl).Err()
+	return err
 }
 
-func (r *Registry) Deregister(ctx context.Context, service *registry.ServiceInstance) error {
-	r.ticker.Stop()
-	r.cancel()
-	key := fmt.Sprintf(keyFormat, r.opts.namespace, service.Name, service.ID)
-	return r.client.Del(ctx, key).Err()
+// expiry pads the TTL so a renewal in flight does not race the expiration.
+// It is 0 for persistent registrations.
+func (r *Registry) expiry(ttl time.Duration) time.Duration {
+	if r.opts.persistent {
+		return 0
+	}
+	return ttl + 2*time.Second + jitter(ttl, r.opts.jitter)
 }
 
-func services(ctx context.Context, client *redis.Client, key string) ([]*registry.ServiceInstance, error) {
-	key = key + "*"
-	var cursor uint64
-	items := make([]*registry.ServiceInstance, 0)
+// register writes the lease's instance and reports whether the key already existed.
+func (r *Registry) register(ctx context.Context, l *Lease) (bool, error) {
+	expiry := r.expiry(r.opts.ttl)
+	value, err := l.value(expiry)
+	if err != nil {
+		return false, err
+	}
+	existed, err := r.run(ctx, r.client, r.layout.register, r.scriptKeys(l), r.scriptArgs(l, value, expiry)...).Int()
+	return existed == 1, err
+}
 
-	for {
-		var keys []string
-		var err error
-		keys, cursor, err = client.Scan(ctx, cursor, key, defaultScan).Result()
-		if err != nil {
-			return nil, err
+// pipelined writes the leases with a single pipeline and returns the error
+// of each write.
+func (r *Registry) pipelined(ctx context.Context, leases []*Lease) []error {
+	cmds := make([]*redis.Cmd, len(leases))
+	errs := make([]error, len(leases))
+	r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, l := range leases {
+			expiry := r.expiry(r.opts.ttl)
+			value, err := l.value(expiry)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			cmds[i] = r.run(ctx, pipe, r.layout.register, r.scriptKeys(l), r.scriptArgs(l, value, expiry)...)
 		}
-		if len(keys) == 0 {
-			break
+		return nil
+	})
+	for i, l := range leases {
+		if errs[i] != nil {
+			continue
 		}
-		res, err := client.MGet(ctx, keys...).Result()
-		if err != nil {
-			return nil, err
+		existed, err := cmds[i].Int()
+		if err == nil && existed == 0 {
+			r.restored(l.instance())
+		}
+		if isFunctionMissing(err) {
+			// reloaded by the retry
+			r.fns.reset()
+		}
+		errs[i] = err
+	}
+	return errs
+}
+
+func (r *Registry) registerNX(ctx context.Context, l *Lease) error {
+	expiry := r.expiry(r.opts.ttl)
+	value, err := l.value(expiry)
+	if err != nil {
+		return err
+	}
+	ok, err := r.run(ctx, r.client, r.layout.registerNX, r.scriptKeys(l), r.scriptArgs(l, value, expiry)...).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrAlreadyRegistered
+	}
+	return nil
+}
+
+func (r *Registry) Deregister(ctx context.Context, service *registry.ServiceInstance) error {
+	if r.opts.grace > 0 {
+		err := r.retire(ctx, service, MetadataTerminating, r.opts.grace)
+		if !errors.Is(err, ErrNotRegistered) {
+			return err
 		}
+	}
+	return r.deregister(ctx, service)
+}
+
+// retire flags the instance with the metadata key, keeps it alive for the
+// grace period and deregisters it.
+func (r *Registry) retire(ctx context.Context, service *registry.ServiceInstance, flag string, grace time.Duration) error {
+	if err := r.Update(ctx, withMetadata(service, flag, "true")); err != nil {
+		return err
+	}
 
-		for _, v := range res {
-			switch str := v.(type) {
-			case string:
-				si := new(registry.ServiceInstance)
-				if err := jsoniter.UnmarshalFromString(str, si); err != nil {
-					return nil, err
-				}
-				items = append(items, si)
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// stop the heartbeat anyway, the key expires on its own
+	case <-timer.C:
+	}
+	return r.deregister(ctx, service)
+}
+
+func (r *Registry) deregister(ctx context.Context, service *registry.ServiceInstance) error {
+	id := leaseID(service)
+	r.mu.Lock()
+	if l, ok := r.leases[id]; ok {
+		l.stop()
+		delete(r.leases, id)
+	}
+	r.mu.Unlock()
+
+	keys, args := r.instanceKeys(service.Name, service.ID), r.removeArgs(service.ID)
+	err := r.breaker.guarded(func() error {
+		return r.retry(ctx, OpDeregister, func() error {
+			return r.run(ctx, r.client, r.layout.deregister, keys, args...).Err()
+		})
+	})
+	if err != nil {
+		return err
+	}
+	r.publish(ctx, service, EventDeregister)
+	for _, fn := range r.opts.afterDeregister {
+		fn(ctx, service)
+	}
+	return nil
+}
+
+// Refresh immediately rewrites every instance kept alive by the Registry and
+// restarts their heartbeat intervals, e.g. after Redis was flushed. Instances
+// still waiting for RegisterDelay or ReadySignal are left alone. It returns
+// the first error but still tries every instance.
+func (r *Registry) Refresh(ctx context.Context) error {
+	var leases []*Lease
+	for _, l := range r.active() {
+		if !l.isPaused() && !l.isPending() {
+			leases = append(leases, l)
+		}
+	}
+
+	var first error
+	for i, err := range r.pipelined(ctx, leases) {
+		if err != nil {
+			if first == nil {
+				first = err
 			}
+			continue
 		}
-		if cursor == 0 {
-			break
+		r.keepalive(leases[i], r.interval())
+	}
+	return first
+}
+
+// Pause stops renewing the instance with the given id, letting its key expire
+// so it drops out of discovery without being deregistered.
+func (r *Registry) Pause(instanceID string) error {
+	l, ok := r.lookup(instanceID)
+	if !ok {
+		return ErrNotRegistered
+	}
+	l.setPaused(true)
+	return nil
+}
+
+// Resume restarts the heartbeat of a paused instance and writes it again right away.
+func (r *Registry) Resume(instanceID string) error {
+	l, ok := r.lookup(instanceID)
+	if !ok {
+		return ErrNotRegistered
+	}
+	l.setPaused(false)
+	return nil
+}
+
+func (r *Registry) lookup(instanceID string) (*Lease, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.leases {
+		if l.instance().ID == instanceID {
+			return l, true
 		}
 	}
+	return nil, false
+}
+
+// Drain marks the instance as draining, keeps it alive for the grace period so
+// clients can move away, then deregisters it.
+func (r *Registry) Drain(ctx context.Context, service *registry.ServiceInstance, grace time.Duration) error {
+	return r.retire(ctx, service, MetadataDraining, grace)
+}
 
-	return items, nil
+// deregisterAll best-effort removes every instance kept alive by the Registry,
+// waiting out their grace periods together.
+func (r *Registry) deregisterAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, l := range r.active() {
+		wg.Add(1)
+		go func(service *registry.ServiceInstance) {
+			defer wg.Done()
+			r.Deregister(ctx, service)
+		}(l.instance())
+	}
+	wg.Wait()
+}
+
+// deregisterTimeout bounds a Deregister the Registry issues on its own,
+// leaving room for the DeregisterGrace period.
+func (r *Registry) deregisterTimeout() time.Duration {
+	return r.opts.grace + r.opts.opTimeout
+}
+
+// Close stops the heartbeats of all registered instances and waits until the
+// background goroutines exited or ctx is done. Keys are left to expire unless
+// AutoDeregister is set, which deregisters them within ctx, so it must leave
+// room for the DeregisterGrace period. The client is closed when NewFromURL
+// created it.
+func (r *Registry) Close(ctx context.Context) error {
+	if r.opts.autoDereg {
+		r.deregisterAll(ctx)
+	}
+	r.mu.Lock()
+	for id, l := range r.leases {
+		l.stop()
+		delete(r.leases, id)
+	}
+	r.mu.Unlock()
+	r.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-done:
+	}
+	if r.owned {
+		if cerr := r.client.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// active returns the leases currently kept alive.
+func (r *Registry) active() []*Lease {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	leases := make([]*Lease, 0, len(r.leases))
+	for _, l := range r.leases {
+		leases = append(leases, l)
+	}
+	return leases
+}
+
+// goroutine runs fn in the background, tracked by Close.
+func (r *Registry) goroutine(fn func()) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		fn()
+	}()
+}
+
+// DeregisterService removes every instance of the service in the namespace,
+// including those registered by other processes.
+func (r *Registry) DeregisterService(ctx context.Context, serviceName string) error {
+	r.mu.Lock()
+	for id, l := range r.leases {
+		if l.instance().Name == serviceName {
+			l.stop()
+			delete(r.leases, id)
+		}
+	}
+	r.mu.Unlock()
+
+	if r.opts.hash {
+		return r.deregisterHash(ctx, serviceName)
+	}
+	return r.scan(ctx, r.client, r.pattern(serviceName), func(keys []string, values []interface{}) error {
+		var (
+			del       []string
+			instances []*registry.ServiceInstance
+		)
+		for i, v := range values {
+			str, ok := v.(string)
+			if !ok {
+				continue
+			}
+			si, err := decode(str)
+			if err != nil || si.Name != serviceName {
+				continue
+			}
+			del = append(del, keys[i])
+			instances = append(instances, si)
+		}
+		if len(del) == 0 {
+			return nil
+		}
+		_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			// one key per command, they may live in different cluster slots
+			for _, key := range del {
+				pipe.Del(ctx, key)
+			}
+			if r.opts.index {
+				pipe.Del(ctx, r.index(serviceName))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, si := range instances {
+			r.publish(ctx, si, EventDeregister)
+		}
+		return nil
+	})
 }
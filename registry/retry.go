@@ -0,0 +1,164 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+)
+
+// Operation is a kind of Redis command issued by the Registry, retried with
+// its own RetryPolicy.
+type Operation string
+
+const (
+	// OpRegister is the initial write of an instance by Register.
+	OpRegister Operation = "register"
+	// OpHeartbeat is the renewal of an instance, retried by the scheduler
+	// without blocking the other renewals.
+	OpHeartbeat Operation = "heartbeat"
+	// OpDeregister is the removal of an instance.
+	OpDeregister Operation = "deregister"
+	// OpDiscovery is the read of the instances of a service.
+	OpDiscovery Operation = "discovery"
+)
+
+// RetryPolicy tells how an operation is retried by the Registry, on top of
+// the retries of the client.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, 0 and 1 disable retries.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled after each one.
+	Backoff time.Duration
+	// MaxBackoff caps the delay, a minute when 0 unless Backoff is longer.
+	MaxBackoff time.Duration
+	// Retryable classifies the errors worth retrying, all of them when nil.
+	// Cancellations, malformed entries and instances claimed by another
+	// registry are never retried.
+	Retryable func(error) bool
+}
+
+// maxBackoff caps the delays of the policies without MaxBackoff.
+const maxBackoff = time.Minute
+
+// delay returns the delay before the given retry, counted from 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	limit := p.MaxBackoff
+	if limit == 0 {
+		limit = maxBackoff
+		if p.Backoff > limit {
+			limit = p.Backoff
+		}
+	}
+	// doubled one retry at a time, as shifting overflows for late retries
+	d := p.Backoff
+	for i := 1; i < retry && d > 0 && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	return d
+}
+
+// retries reports whether the attempt that failed with err may be retried.
+func (p RetryPolicy) retries(attempt int, err error) bool {
+	switch {
+	case attempt >= p.MaxAttempts,
+		errors.Is(err, ErrAlreadyRegistered), errors.Is(err, ErrMalformed),
+		errors.Is(err, context.Canceled):
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// defaultRetry holds the policies of the operations without Retry.
+var defaultRetry = map[Operation]RetryPolicy{
+	OpHeartbeat: {MaxAttempts: heartbeatRetries, Backoff: heartbeatBackoff},
+	OpDiscovery: {Retryable: retryable},
+}
+
+// Retry sets the retry policy of an operation, e.g. to retry registrations
+// longer than discovery, whose callers are waiting.
+func Retry(op Operation, policy RetryPolicy) Option {
+	return func(o *options) {
+		if o.retry == nil {
+			o.retry = make(map[Operation]RetryPolicy)
+		}
+		o.retry[op] = policy
+	}
+}
+
+// DiscoveryRetry retries discovery up to max times on transient Redis errors,
+// doubling backoff after each attempt. Malformed entries and other permanent
+// errors are returned right away.
+func DiscoveryRetry(max int, backoff time.Duration) Option {
+	return Retry(OpDiscovery, RetryPolicy{MaxAttempts: max + 1, Backoff: backoff, Retryable: retryable})
+}
+
+func (o *options) validateRetry() error {
+	for op, p := range o.retry {
+		if p.MaxAttempts < 0 || p.Backoff < 0 || p.MaxBackoff < 0 {
+			return fmt.Errorf("%w: negative %s retry", ErrInvalidConfig, op)
+		}
+	}
+	return nil
+}
+
+// policy returns the retry policy of the operation.
+func (r *Registry) policy(op Operation) RetryPolicy {
+	if p, ok := r.opts.retry[op]; ok {
+		return p
+	}
+	return defaultRetry[op]
+}
+
+// retry runs fn until it succeeds or the policy of op gives up, and returns
+// its last error.
+func (r *Registry) retry(ctx context.Context, op Operation, fn func() error) error {
+	p := r.policy(op)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !p.retries(attempt, err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(p.delay(attempt)):
+		}
+	}
+}
+
+// retryable reports whether err is a transient failure worth retrying:
+// network errors and the replies of a Redis that is temporarily unavailable.
+func retryable(err error) bool {
+	if errors.Is(err, ErrMalformed) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var reply redis.Error
+	if errors.As(err, &reply) {
+		for _, prefix := range []string{"LOADING ", "READONLY ", "CLUSTERDOWN ", "TRYAGAIN ", "MASTERDOWN "} {
+			if strings.HasPrefix(reply.Error(), prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// discoverRetry runs discover with the discovery retry policy.
+func (r *Registry) discoverRetry(ctx context.Context, service string) ([]*registry.ServiceInstance, error) {
+	var items []*registry.ServiceInstance
+	err := r.retry(ctx, OpDiscovery, func() (err error) {
+		items, err = r.discover(ctx, service)
+		return err
+	})
+	return items, err
+}
@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		retry  int
+		want   time.Duration
+	}{
+		{"first retry", RetryPolicy{Backoff: 100 * time.Millisecond}, 1, 100 * time.Millisecond},
+		{"doubled", RetryPolicy{Backoff: 100 * time.Millisecond}, 3, 400 * time.Millisecond},
+		{"capped", RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 5, time.Second},
+		{"below the cap", RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 4, 800 * time.Millisecond},
+		{"default cap", RetryPolicy{Backoff: time.Second}, 10, maxBackoff},
+		{"no overflow without cap", RetryPolicy{Backoff: time.Second}, 100, maxBackoff},
+		{"no overflow with cap", RetryPolicy{Backoff: time.Second, MaxBackoff: time.Hour}, 1000, time.Hour},
+		{"backoff over the default cap", RetryPolicy{Backoff: 2 * time.Minute}, 3, 2 * time.Minute},
+		{"backoff over the cap", RetryPolicy{Backoff: time.Second, MaxBackoff: 500 * time.Millisecond}, 1, 500 * time.Millisecond},
+		{"no backoff", RetryPolicy{}, 1 << 20, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.delay(tt.retry); got != tt.want {
+			t.Errorf("%s: delay(%d) = %s, want %s", tt.name, tt.retry, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyRetries(t *testing.T) {
+	transient := errors.New("i/o timeout")
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		err     error
+		want    bool
+	}{
+		{"disabled", RetryPolicy{}, 1, transient, false},
+		{"within attempts", RetryPolicy{MaxAttempts: 3}, 2, transient, true},
+		{"attempts exhausted", RetryPolicy{MaxAttempts: 3}, 3, transient, false},
+		{"already registered", RetryPolicy{MaxAttempts: 3}, 1, ErrAlreadyRegistered, false},
+		{"malformed", RetryPolicy{MaxAttempts: 3}, 1, ErrMalformed, false},
+		{"canceled", RetryPolicy{MaxAttempts: 3}, 1, context.Canceled, false},
+		{"classified permanent", RetryPolicy{MaxAttempts: 3, Retryable: retryable}, 1, proto("ERR wrong number of arguments"), false},
+		{"classified transient", RetryPolicy{MaxAttempts: 3, Retryable: retryable}, 1, proto("LOADING Redis is loading the dataset in memory"), true},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.retries(tt.attempt, tt.err); got != tt.want {
+			t.Errorf("%s: retries(%d, %v) = %v, want %v", tt.name, tt.attempt, tt.err, got, tt.want)
+		}
+	}
+}
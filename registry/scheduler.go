@@ -0,0 +1,210 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	wheelSlots = 64
+	// leases due within the next quarter of the wheel, half a heartbeat
+	// interval, are renewed early together with the ones due now
+	lookahead = wheelSlots / 4
+	minTick   = 10 * time.Millisecond
+)
+
+// scheduler renews every lease of a Registry from a single goroutine. Leases
+// wait in a timer wheel covering two heartbeat intervals, and the ones falling
+// due on the same tick are renewed with one pipeline.
+type scheduler struct {
+	r     *Registry
+	tick  time.Duration
+	mu    sync.Mutex
+	slots [][]slot
+	pos   int
+	// when renewals started failing over, owned by the scheduler goroutine
+	failed time.Time
+}
+
+type slot struct {
+	l      *Lease
+	gen    uint64
+	rounds int
+}
+
+func newScheduler(r *Registry) *scheduler {
+	tick := 2 * r.opts.heartbeat / wheelSlots
+	if tick < minTick {
+		tick = minTick
+	}
+	return &scheduler{
+		r:     r,
+		tick:  tick,
+		slots: make([][]slot, wheelSlots),
+	}
+}
+
+// schedule renews the lease after the given delay, replacing any renewal
+// scheduled before.
+func (s *scheduler) schedule(l *Lease, after time.Duration) {
+	ticks := int((after + s.tick - 1) / s.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l.gen++
+	i := (s.pos + ticks) % len(s.slots)
+	s.slots[i] = append(s.slots[i], slot{l: l, gen: l.gen, rounds: (ticks - 1) / len(s.slots)})
+}
+
+// advance moves the wheel one tick forward and returns the leases due. When
+// any lease is due, the ones falling due shortly after are returned as well,
+// so instances registered at different times converge on shared pipelines.
+func (s *scheduler) advance() []*Lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pos = (s.pos + 1) % len(s.slots)
+	due := s.take(s.pos, true, nil)
+	if len(due) == 0 {
+		return nil
+	}
+	for i := 1; i <= lookahead; i++ {
+		due = s.take((s.pos+i)%len(s.slots), false, due)
+	}
+	return due
+}
+
+// take removes the leases due in slot i and appends them to due. When tick is
+// set, the slot is being passed and the rounds of the other entries count down.
+func (s *scheduler) take(i int, tick bool, due []*Lease) []*Lease {
+	pending := s.slots[i][:0]
+	for _, e := range s.slots[i] {
+		switch {
+		case e.gen != e.l.gen || e.l.ctx.Err() != nil:
+			// rescheduled or stopped meanwhile
+		case e.rounds > 0:
+			if tick {
+				e.rounds--
+			}
+			pending = append(pending, e)
+		default:
+			due = append(due, e.l)
+		}
+	}
+	s.slots[i] = pending
+	return due
+}
+
+func (s *scheduler) run() {
+	defer func() {
+		for _, l := range s.r.active() {
+			l.stop()
+		}
+	}()
+	for s.r.protect(s.loop, s.report) {
+		select {
+		case <-s.r.ctx.Done():
+			return
+		case <-time.After(heartbeatBackoff):
+		}
+	}
+}
+
+func (s *scheduler) report(err error) {
+	if s.r.opts.onError != nil {
+		s.r.opts.onError(err)
+	}
+}
+
+func (s *scheduler) loop() {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if due := s.advance(); len(due) > 0 {
+			s.renew(due)
+		}
+	}
+}
+
+// renew writes the due leases with a single pipeline.
+func (s *scheduler) renew(due []*Lease) {
+	r := s.r
+	writes := due[:0]
+	for _, l := range due {
+		if l.isPaused() {
+			// a paused lease is expected to lapse
+			l.renewed = time.Now()
+			s.schedule(l, r.interval())
+			continue
+		}
+		writes = append(writes, l)
+	}
+	if len(writes) == 0 {
+		return
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			// a decorator or OnRestore panicked: the loop restarts, but the
+			// leases taken off the wheel must be renewed again
+			for _, l := range writes {
+				if l.ctx.Err() == nil {
+					s.schedule(l, heartbeatBackoff)
+				}
+			}
+			panic(v)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(r.ctx, r.opts.opTimeout)
+	defer cancel()
+	errs := r.pipelined(ctx, writes)
+	s.failover(writes, errs)
+	var first error
+	for _, err := range errs {
+		if err != nil {
+			first = err
+			break
+		}
+	}
+	r.breaker.record(first)
+	for i, err := range errs {
+		s.renewal(writes[i], err)
+	}
+}
+
+// renewal records the outcome of a renewal and schedules the next one,
+// retrying failures as configured with the OpHeartbeat RetryPolicy before
+// reporting them.
+func (s *scheduler) renewal(l *Lease, err error) {
+	if l.ctx.Err() != nil {
+		return
+	}
+	if err == nil {
+		l.renewed, l.attempts = time.Now(), 0
+		s.schedule(l, s.r.interval())
+		return
+	}
+	if p := s.r.policy(OpHeartbeat); p.retries(l.attempts+1, err) {
+		l.attempts++
+		s.schedule(l, p.delay(l.attempts))
+		return
+	}
+	l.attempts = 0
+	l.report(err)
+	if time.Since(l.renewed) > s.r.opts.ttl {
+		l.report(ErrLeaseExpired)
+	}
+	if !s.failed.IsZero() {
+		// keep retrying to re-register as soon as the new master is writable
+		s.schedule(l, heartbeatBackoff<<(heartbeatRetries-1))
+		return
+	}
+	s.schedule(l, s.r.interval())
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+)
+
+// renewals counts the registration scripts run by fakePipeliner.
+var renewals int64
+
+func (p fakePipeliner) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	atomic.AddInt64(&renewals, 1)
+	return redis.NewCmdResult(int64(1), nil)
+}
+
+func TestRenewalSurvivesPanic(t *testing.T) {
+	var decorated int64
+	panics := make(chan error, 1)
+	r := newTestRegistry(t, new(fakeClient),
+		TTL(time.Second),
+		HeartbeatInterval(50*time.Millisecond),
+		InstanceDecorator(func(si *registry.ServiceInstance) *registry.ServiceInstance {
+			if atomic.AddInt64(&decorated, 1) == 1 {
+				panic("decorator")
+			}
+			return si
+		}),
+		OnHeartbeatError(func(err error) {
+			select {
+			case panics <- err:
+			default:
+			}
+		}),
+	)
+	atomic.StoreInt64(&renewals, 0)
+	r.keepalive(newLease(r, &registry.ServiceInstance{ID: "1", Name: "user"}), 0)
+
+	select {
+	case err := <-panics:
+		if !errors.Is(err, ErrPanic) {
+			t.Fatalf("got %v, want ErrPanic", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the panic was not reported")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&renewals) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d renewals after the panic, want the lease to keep renewing", atomic.LoadInt64(&renewals))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,93 @@
+package registry
+
+import "github.com/go-redis/redis/v8"
+
+// registerScript rewrites the instance value together with its TTL so that
+// changes of the in-memory instance are propagated on every heartbeat. A TTL
+// of 0 writes the key without expiration. It returns 1 when the key already
+// existed. The optional KEYS[2] is the service index the key is added to.
+var registerScript = redis.NewScript(registerSource)
+
+const registerSource = `
+local existed = redis.call("EXISTS", KEYS[1])
+if tonumber(ARGV[2]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+if KEYS[2] then
+	redis.call("SADD", KEYS[2], KEYS[1])
+end
+return existed
+`
+
+// registerNXScript writes the instance unless the key holds a different one.
+// Timestamps are ignored when comparing, so the same instance restarting is
+// not a conflict. It returns 0 when the key is claimed by someone else. Like
+// registerScript it adds the key to the optional KEYS[2] index.
+var registerNXScript = redis.NewScript(registerNXSource)
+
+const registerNXSource = sameInstanceSource + `
+local current = redis.call("GET", KEYS[1])
+if current and not same(current, ARGV[1]) then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+if KEYS[2] then
+	redis.call("SADD", KEYS[2], KEYS[1])
+end
+return 1
+`
+
+// deregisterScript deletes the instance key and removes it from the optional
+// KEYS[2] index.
+var deregisterScript = redis.NewScript(deregisterSource)
+
+const deregisterSource = `
+redis.call("DEL", KEYS[1])
+if KEYS[2] then
+	redis.call("SREM", KEYS[2], KEYS[1])
+end
+return 1
+`
+
+// sameInstanceSource defines same(current, value), which reports whether two
+// stored values hold the same instance, timestamps aside.
+const sameInstanceSource = `
+local function equal(a, b)
+	if type(a) ~= type(b) then
+		return false
+	end
+	if type(a) ~= "table" then
+		return a == b
+	end
+	for k, v in pairs(a) do
+		if not equal(v, b[k]) then
+			return false
+		end
+	end
+	for k in pairs(b) do
+		if a[k] == nil then
+			return false
+		end
+	end
+	return true
+end
+
+local function same(current, value)
+	local ok, old = pcall(cjson.decode, current)
+	if not ok then
+		return false
+	end
+	local new = cjson.decode(value)
+	for _, field in ipairs({"schema", "registeredAt", "lastHeartbeat", "expiresAt"}) do
+		old[field] = nil
+		new[field] = nil
+	end
+	return equal(old, new)
+end
+`
@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+// Selector only discovers instances whose metadata matches the label selector,
+// a comma separated list of requirements that must all hold: "key=value",
+// "key!=value", "key" (present) and "!key" (absent), e.g. "env=prod,region=us-east-1".
+func Selector(selector string) Option {
+	return func(o *options) {
+		match, err := parseSelector(selector)
+		if err != nil {
+			if o.invalid == nil {
+				o.invalid = err
+			}
+			return
+		}
+		o.filters = append(o.filters, func(si *registry.ServiceInstance) bool {
+			return match(si.Metadata)
+		})
+	}
+}
+
+func parseSelector(selector string) (func(map[string]string) bool, error) {
+	var reqs []func(map[string]string) bool
+	for _, req := range strings.Split(selector, ",") {
+		req = strings.TrimSpace(req)
+		if req == "" {
+			continue
+		}
+		var (
+			key, value string
+			negate     bool
+			exists     bool
+		)
+		switch {
+		case strings.Contains(req, "!="):
+			i := strings.Index(req, "!=")
+			key, value, negate = req[:i], req[i+2:], true
+		case strings.Contains(req, "=="):
+			i := strings.Index(req, "==")
+			key, value = req[:i], req[i+2:]
+		case strings.Contains(req, "="):
+			i := strings.Index(req, "=")
+			key, value = req[:i], req[i+1:]
+		case strings.HasPrefix(req, "!"):
+			key, exists, negate = req[1:], true, true
+		default:
+			key, exists = req, true
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "" || strings.ContainsAny(key, "!=") {
+			return nil, fmt.Errorf("invalid label selector requirement %q", req)
+		}
+
+		if exists {
+			reqs = append(reqs, func(md map[string]string) bool {
+				_, ok := md[key]
+				return ok != negate
+			})
+			continue
+		}
+		reqs = append(reqs, func(md map[string]string) bool {
+			v, ok := md[key]
+			return (ok && v == value) != negate
+		})
+	}
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("empty label selector")
+	}
+	return func(md map[string]string) bool {
+		for _, req := range reqs {
+			if !req(md) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,46 @@
+package registry
+
+import "testing"
+
+func TestParseSelector(t *testing.T) {
+	md := map[string]string{"env": "prod", "zone": "eu-1", "canary": ""}
+	tests := []struct {
+		selector string
+		match    bool
+	}{
+		{"env=prod", true},
+		{"env==prod", true},
+		{"env = prod", true},
+		{"env=staging", false},
+		{"env!=staging", true},
+		{"env!=prod", false},
+		{"tier!=web", true},
+		{"tier=web", false},
+		{"canary", true},
+		{"canary=", true},
+		{"tier", false},
+		{"!tier", true},
+		{"!canary", false},
+		{"env=prod,zone=eu-1", true},
+		{"env=prod, zone=eu-2", false},
+		{"env=prod,,!tier,", true},
+	}
+	for _, tt := range tests {
+		match, err := parseSelector(tt.selector)
+		if err != nil {
+			t.Errorf("parseSelector(%q): %v", tt.selector, err)
+			continue
+		}
+		if got := match(md); got != tt.match {
+			t.Errorf("selector %q matching %v = %v, want %v", tt.selector, md, got, tt.match)
+		}
+	}
+}
+
+func TestParseSelectorInvalid(t *testing.T) {
+	for _, selector := range []string{"", " , ", "=prod", "!", "!=prod", "!!env"} {
+		if _, err := parseSelector(selector); err == nil {
+			t.Errorf("parseSelector(%q) succeeded", selector)
+		}
+	}
+}
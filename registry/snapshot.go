@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+)
+
+// snapshotScript reads every instance of a service atomically: from the index
+// KEYS[1] when given, otherwise by scanning ARGV[1] with page size ARGV[2]. It
+// returns key and value pairs.
+var snapshotScript = redis.NewScript(`
+local keys = {}
+if KEYS[1] then
+	keys = redis.call("SMEMBERS", KEYS[1])
+else
+	local cursor = "0"
+	repeat
+		local page = redis.call("SCAN", cursor, "MATCH", ARGV[1], "COUNT", ARGV[2])
+		cursor = page[1]
+		for _, key in ipairs(page[2]) do
+			keys[#keys + 1] = key
+		end
+	until cursor == "0"
+end
+local result = {}
+for _, key in ipairs(keys) do
+	local value = redis.pcall("GET", key)
+	if type(value) == "string" then
+		result[#result + 1] = key
+		result[#result + 1] = value
+	end
+end
+return result
+`)
+
+// SnapshotReads makes discovery read all instances of a service with one Lua
+// script, returning a consistent point-in-time view even under heavy churn.
+// Without Index the script scans the keyspace and blocks Redis meanwhile, so
+// it is best combined with Index, which Cluster and Ring clients require.
+func SnapshotReads() Option {
+	return func(o *options) { o.snapshot = true }
+}
+
+func (r *Registry) snapshot(ctx context.Context, service string) ([]*registry.ServiceInstance, error) {
+	var keys []string
+	if r.opts.index {
+		keys = []string{r.index(service)}
+	}
+	reply, err := snapshotScript.Run(ctx, r.reader, keys, r.pattern(service), defaultScan).Result()
+	if err != nil {
+		return nil, err
+	}
+	// key and value pairs
+	pairs, _ := reply.([]interface{})
+
+	items := make([]*registry.ServiceInstance, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		key, _ := pairs[i].(string)
+		value, _ := pairs[i+1].(string)
+		si, err := decode(value)
+		if err != nil {
+			if err = r.malformed(key, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		items = append(items, si)
+	}
+	return items, nil
+}
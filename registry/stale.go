@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+// StaleFallback makes GetService and watchers return the last instances
+// fetched successfully, if not older than maxAge, when Redis cannot be
+// reached, so a Redis blip does not empty client-side load balancers.
+func StaleFallback(maxAge time.Duration) Option {
+	return func(o *options) { o.maxStale = maxAge }
+}
+
+type snapshot struct {
+	items   []*registry.ServiceInstance
+	fetched time.Time
+}
+
+// staleCache keeps the last successful discovery result per service.
+type staleCache struct {
+	mu        sync.Mutex
+	snapshots map[string]snapshot
+}
+
+func (c *staleCache) store(service string, items []*registry.ServiceInstance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.snapshots == nil {
+		c.snapshots = make(map[string]snapshot)
+	}
+	c.snapshots[service] = snapshot{items: items, fetched: time.Now()}
+}
+
+// load returns the instances of the service stored no longer than maxAge ago,
+// or whenever stored when maxAge is 0.
+func (c *staleCache) load(service string, maxAge time.Duration) ([]*registry.ServiceInstance, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.snapshots[service]
+	if !ok || maxAge > 0 && time.Since(s.fetched) > maxAge {
+		return nil, false
+	}
+	return copyInstances(s.items), true
+}
+
+func (c *staleCache) drop(service string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.snapshots, service)
+}
+
+// fallback returns the last known instances of the service when err is a
+// Redis failure rather than the caller giving up: those fetched last if not
+// older than the StaleFallback, else those of the OfflineSnapshot until the
+// service was read once.
+func (r *Registry) fallback(service string, items []*registry.ServiceInstance, err error) ([]*registry.ServiceInstance, error) {
+	if r.opts.maxStale <= 0 && r.opts.offlinePath == "" {
+		return items, err
+	}
+	if err == nil {
+		r.stale.store(service, copyInstances(items))
+		r.offline.drop(service)
+		return items, nil
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+	if r.opts.maxStale > 0 {
+		if last, ok := r.stale.load(service, r.opts.maxStale); ok {
+			r.opts.logger.Log(log.LevelError, "msg", "registry: discovery failed, returning last known instances", "service", service, "error", err)
+			return last, nil
+		}
+	}
+	if saved, ok := r.offline.load(service, 0); ok {
+		r.opts.logger.Log(log.LevelError, "msg", "registry: discovery failed, returning the offline snapshot", "service", service, "error", err)
+		return saved, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,194 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	_ registry.Watcher = (*StreamWatcher)(nil)
+)
+
+// streamBlock bounds each blocking read of a StreamWatcher, and so how long
+// Stop may wait for a pending Next.
+const streamBlock = time.Second
+
+// StreamEvents records the events of every service into a per-service Redis
+// stream trimmed to about maxLen entries, so that StreamWatchers can resume
+// after a reconnect without missing changes.
+func StreamEvents(maxLen int64) Option {
+	return func(o *options) { o.streamLen = maxLen }
+}
+
+// StreamEvent is an event recorded in the stream of a service, at Position.
+type StreamEvent struct {
+	Position string
+	Event
+}
+
+func (r *Registry) stream(service string) string {
+	return r.join(r.opts.namespace, "_stream", r.escape(service))
+}
+
+// appendEvent appends the event to the stream of the service.
+func (r *Registry) appendEvent(ctx context.Context, service *registry.ServiceInstance, ev *Event) {
+	if r.opts.streamLen <= 0 {
+		return
+	}
+	r.client.XAdd(ctx, xaddArgs(r.stream(service.Name), r.opts.streamLen, map[string]interface{}{
+		"service": ev.Service,
+		"id":      ev.ID,
+		"action":  ev.Action,
+	}))
+}
+
+func streamEvents(messages []redis.XMessage) []StreamEvent {
+	events := make([]StreamEvent, 0, len(messages))
+	for _, msg := range messages {
+		ev := StreamEvent{Position: msg.ID}
+		ev.Service, _ = msg.Values["service"].(string)
+		ev.ID, _ = msg.Values["id"].(string)
+		ev.Action, _ = msg.Values["action"].(string)
+		events = append(events, ev)
+	}
+	return events
+}
+
+// History returns the events of the service recorded after position, in
+// order. An empty position returns the whole recorded history.
+func (r *Registry) History(ctx context.Context, service, position string) ([]StreamEvent, error) {
+	start := "-"
+	if position != "" {
+		start = position
+	}
+	messages, err := r.reader.XRange(ctx, r.stream(service), start, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) > 0 && messages[0].ID == position {
+		messages = messages[1:]
+	}
+	return streamEvents(messages), nil
+}
+
+// StreamWatcher watches a service by reading its event stream from the last
+// seen position, see StreamEvents. It returns the instances of the service
+// whenever they changed, also re-reading them every WatcherTTL in case the
+// stream got trimmed.
+type StreamWatcher struct {
+	r       *Registry
+	service string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopper
+
+	mu      sync.Mutex
+	pos     string
+	started bool
+	last    uint64
+}
+
+// WatchStream watches the service from position, as returned by
+// StreamWatcher.Position, or from now when position is empty.
+func (r *Registry) WatchStream(ctx context.Context, service, position string) (*StreamWatcher, error) {
+	if position == "" {
+		position = "0-0"
+		messages, err := r.reader.XRevRangeN(ctx, r.stream(service), "+", "-", 1).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) > 0 {
+			position = messages[0].ID
+		}
+	}
+	w := &StreamWatcher{r: r, service: service, pos: position, stopper: newStopper()}
+	w.ctx, w.cancel = context.WithCancel(r.watchContext(ctx))
+	return w, nil
+}
+
+// Position returns the stream position of the last event the watcher read.
+func (w *StreamWatcher) Position() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.pos
+}
+
+// Next returns the current instances right away on the first call, then
+// blocks until an event of the service changed them.
+func (w *StreamWatcher) Next() ([]*registry.ServiceInstance, error) {
+	items, err := w.next()
+	return items, w.err(err)
+}
+
+func (w *StreamWatcher) next() ([]*registry.ServiceInstance, error) {
+	for {
+		if w.started {
+			if err := w.wait(); err != nil {
+				return nil, err
+			}
+		}
+
+		items, err := w.r.instances(w.ctx, w.service)
+		if err != nil {
+			return nil, err
+		}
+		sum := fingerprint(items)
+		if w.started && sum == w.last {
+			continue
+		}
+		w.started, w.last = true, sum
+		return items, nil
+	}
+}
+
+// wait blocks until the stream has events past the position or the watcher
+// TTL passed. It reads with short blocks and checks the context in between,
+// as go-redis does not interrupt a blocking read when it is cancelled.
+func (w *StreamWatcher) wait() error {
+	deadline := time.Now().Add(w.r.opts.watcherTtl)
+	for {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		block := time.Until(deadline)
+		if block < time.Millisecond {
+			// a zero block would wait forever
+			return nil
+		}
+		if block > streamBlock {
+			block = streamBlock
+		}
+		streams, err := w.r.reader.XRead(w.ctx, &redis.XReadArgs{
+			Streams: []string{w.r.stream(w.service), w.Position()},
+			Block:   block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if w.ctx.Err() != nil {
+				return w.ctx.Err()
+			}
+			return err
+		}
+		for _, s := range streams {
+			if n := len(s.Messages); n > 0 {
+				w.mu.Lock()
+				w.pos = s.Messages[n-1].ID
+				w.mu.Unlock()
+			}
+		}
+		return nil
+	}
+}
+
+func (w *StreamWatcher) Stop() error {
+	w.stop(w.cancel)
+
+	return nil
+}
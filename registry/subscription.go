@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// EventResync is delivered by a Subscription in place of the events it had to
+// discard, telling the consumer to re-read the services it follows.
+const EventResync = "resync"
+
+// Subscription delivers the events of the namespace through a bounded buffer,
+// so that a slow consumer cannot grow memory without limits.
+type Subscription struct {
+	pubsub *redis.PubSub
+	q      *queue
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Subscribe delivers the events of the namespace, buffering up to size events,
+// until ctx is done or the Subscription is closed.
+func (r *Registry) Subscribe(ctx context.Context, size int, overflow Overflow) *Subscription {
+	s := &Subscription{
+		pubsub: r.client.Subscribe(ctx, r.EventChannel()),
+		q:      newQueue(size, overflow, Event{Action: EventResync}),
+		done:   make(chan struct{}),
+	}
+	go s.receive()
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.done:
+		}
+	}()
+	return s
+}
+
+func (s *Subscription) receive() {
+	for msg := range s.pubsub.Channel() {
+		var ev Event
+		if err := jsoniter.UnmarshalFromString(msg.Payload, &ev); err != nil {
+			continue
+		}
+		s.q.push(context.Background(), ev)
+	}
+	s.Close()
+}
+
+// Next blocks until an event arrives and returns it, or returns ErrClosed
+// once the subscription is closed.
+func (s *Subscription) Next() (Event, error) {
+	v, err := s.q.pop(context.Background())
+	if err != nil {
+		return Event{}, err
+	}
+	return v.(Event), nil
+}
+
+// Close stops the subscription, unblocking Next.
+func (s *Subscription) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		s.q.close()
+		err = s.pubsub.Close()
+	})
+	return err
+}
@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig makes NewFromURL connect with cfg, even for a redis:// URL. The
+// server name defaults to the host of the URL. New ignores it.
+func TLSConfig(cfg *tls.Config) Option {
+	return func(o *options) { o.tls = cfg }
+}
+
+// TLSFiles makes NewFromURL connect over TLS, presenting the client
+// certificate in the PEM encoded certFile and keyFile, as managed Redis
+// offerings requiring mutual TLS expect, and trusting the certificate
+// authorities in caFile. Either pair of files may be empty, the client
+// certificate and the system roots are then left out. New ignores it.
+func TLSFiles(certFile, keyFile, caFile string) Option {
+	return func(o *options) {
+		cfg, err := loadTLS(certFile, keyFile, caFile)
+		if err != nil {
+			o.invalid = err
+			return
+		}
+		o.tls = cfg
+	}
+}
+
+func loadTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("certificate authorities: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("certificate authorities: no certificate in %s", caFile)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		addr         string
+		password     string
+		db           int
+		tls          bool
+		poolSize     int
+		minIdleConns int
+		dialTimeout  time.Duration
+		readTimeout  time.Duration
+		writeTimeout time.Duration
+	}{
+		{url: "redis://localhost:6379", addr: "localhost:6379"},
+		{url: "redis://:secret@redis.internal:6380/2", addr: "redis.internal:6380", password: "secret", db: 2},
+		{url: "rediss://redis.internal:6380", addr: "redis.internal:6380", tls: true},
+		{url: "rediss://redis.internal:6380?tls=false", addr: "redis.internal:6380"},
+		{url: "redis://redis.internal:6379?tls=true", addr: "redis.internal:6379", tls: true},
+		{url: "redis://localhost:6379?pool_size=20&min_idle_conns=5", addr: "localhost:6379", poolSize: 20, minIdleConns: 5},
+		{url: "redis://localhost:6379?pool_size=10&pool_size=30", addr: "localhost:6379", poolSize: 30},
+		{
+			url:  "redis://localhost:6379/1?dial_timeout=2s&read_timeout=500ms&write_timeout=1s",
+			addr: "localhost:6379", db: 1, dialTimeout: 2 * time.Second, readTimeout: 500 * time.Millisecond, writeTimeout: time.Second,
+		},
+	}
+	for _, tt := range tests {
+		opt, err := parseURL(tt.url)
+		if err != nil {
+			t.Errorf("parseURL(%q): %v", tt.url, err)
+			continue
+		}
+		if opt.Addr != tt.addr || opt.Password != tt.password || opt.DB != tt.db {
+			t.Errorf("parseURL(%q) = addr %q, password %q, db %d, want %q, %q, %d", tt.url, opt.Addr, opt.Password, opt.DB, tt.addr, tt.password, tt.db)
+		}
+		if tls := opt.TLSConfig != nil; tls != tt.tls {
+			t.Errorf("parseURL(%q) TLS = %v, want %v", tt.url, tls, tt.tls)
+		}
+		if tt.poolSize != 0 && opt.PoolSize != tt.poolSize || tt.minIdleConns != 0 && opt.MinIdleConns != tt.minIdleConns {
+			t.Errorf("parseURL(%q) pool = %d, %d idle, want %d, %d", tt.url, opt.PoolSize, opt.MinIdleConns, tt.poolSize, tt.minIdleConns)
+		}
+		for _, d := range []struct {
+			name      string
+			got, want time.Duration
+		}{
+			{"dial", opt.DialTimeout, tt.dialTimeout},
+			{"read", opt.ReadTimeout, tt.readTimeout},
+			{"write", opt.WriteTimeout, tt.writeTimeout},
+		} {
+			if d.want != 0 && d.got != d.want {
+				t.Errorf("parseURL(%q) %s timeout = %s, want %s", tt.url, d.name, d.got, d.want)
+			}
+		}
+	}
+}
+
+func TestParseURLInvalid(t *testing.T) {
+	for _, rawURL := range []string{
+		"http://localhost:6379",
+		"redis://localhost:6379?tls=maybe",
+		"redis://localhost:6379?pool_size=-1",
+		"redis://localhost:6379?min_idle_conns=many",
+		"redis://localhost:6379?dial_timeout=5",
+		"redis://localhost:6379?max_retries=3",
+		"redis://localhost:6379/db",
+		"redis://%zz",
+	} {
+		if _, err := parseURL(rawURL); err == nil {
+			t.Errorf("parseURL(%q) succeeded", rawURL)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+var (
+	// ErrInvalidInstance is wrapped by every validation error below.
+	ErrInvalidInstance = errors.New("registry: invalid instance")
+
+	ErrEmptyID     = fmt.Errorf("%w: empty id", ErrInvalidInstance)
+	ErrEmptyName   = fmt.Errorf("%w: empty name", ErrInvalidInstance)
+	ErrNoEndpoints = fmt.Errorf("%w: no endpoints", ErrInvalidInstance)
+	ErrInvalidName = fmt.Errorf("%w: invalid name", ErrInvalidInstance)
+)
+
+// validate rejects the instances the Registry cannot store. Names must not
+// contain the separator, which joins them with the namespace in events and,
+// with InteropLayout, in keys, nor start with "_", which the index, expiry,
+// stream and event keys of the namespace use.
+func (r *Registry) validate(service *registry.ServiceInstance) error {
+	switch {
+	case service == nil:
+		return ErrInvalidInstance
+	case service.ID == "":
+		return ErrEmptyID
+	case service.Name == "":
+		return ErrEmptyName
+	case strings.Contains(service.Name, r.opts.separator):
+		return fmt.Errorf("%w: name contains %q", ErrInvalidName, r.opts.separator)
+	case strings.HasPrefix(service.Name, "_"):
+		return fmt.Errorf("%w: names starting with %q are reserved", ErrInvalidName, "_")
+	case len(service.Endpoints) == 0:
+		return ErrNoEndpoints
+	}
+	return nil
+}
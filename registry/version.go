@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/registry"
+)
+
+// Filter hides instances for which keep returns false from GetService and
+// watchers.
+func Filter(keep func(*registry.ServiceInstance) bool) Option {
+	return func(o *options) { o.filters = append(o.filters, keep) }
+}
+
+// VersionConstraint only discovers instances whose Version satisfies the
+// constraint: an exact version ("v1.2.3") or space separated comparisons that
+// must all hold (">=1.2.0 <2.0.0", "!=1.4.1"), where "^1.2" and "~1.2.3"
+// allow compatible minor and patch releases. Instances with a version that is
+// not semver only match an identical exact constraint.
+func VersionConstraint(constraint string) Option {
+	return func(o *options) {
+		match, err := parseConstraint(constraint)
+		if err != nil {
+			if o.invalid == nil {
+				o.invalid = err
+			}
+			return
+		}
+		o.filters = append(o.filters, func(si *registry.ServiceInstance) bool {
+			return match(si.Version)
+		})
+	}
+}
+
+type semver [3]int
+
+func parseVersion(s string) (semver, bool) {
+	var v semver
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if s == "" || len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+func (v semver) compare(o semver) int {
+	for i := range v {
+		switch {
+		case v[i] < o[i]:
+			return -1
+		case v[i] > o[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseConstraint(constraint string) (func(version string) bool, error) {
+	terms := strings.Fields(strings.ReplaceAll(constraint, ",", " "))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+	if len(terms) == 1 && strings.IndexAny(terms[0], "<>=!^~") < 0 {
+		exact := terms[0]
+		want, ok := parseVersion(exact)
+		return func(version string) bool {
+			if version == exact {
+				return true
+			}
+			v, valid := parseVersion(version)
+			return ok && valid && v.compare(want) == 0
+		}, nil
+	}
+
+	var checks []func(semver) bool
+	for _, term := range terms {
+		op := term[:len(term)-len(strings.TrimLeft(term, "<>=!^~"))]
+		want, ok := parseVersion(term[len(op):])
+		if !ok {
+			return nil, fmt.Errorf("invalid version constraint %q", term)
+		}
+		check, err := compareTo(op, want)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return func(version string) bool {
+		v, ok := parseVersion(version)
+		if !ok {
+			return false
+		}
+		for _, check := range checks {
+			if !check(v) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func compareTo(op string, want semver) (func(semver) bool, error) {
+	switch op {
+	case "", "=", "==":
+		return func(v semver) bool { return v.compare(want) == 0 }, nil
+	case "!=":
+		return func(v semver) bool { return v.compare(want) != 0 }, nil
+	case ">":
+		return func(v semver) bool { return v.compare(want) > 0 }, nil
+	case ">=":
+		return func(v semver) bool { return v.compare(want) >= 0 }, nil
+	case "<":
+		return func(v semver) bool { return v.compare(want) < 0 }, nil
+	case "<=":
+		return func(v semver) bool { return v.compare(want) <= 0 }, nil
+	case "^":
+		limit := semver{want[0] + 1}
+		if want[0] == 0 {
+			limit = semver{0, want[1] + 1}
+		}
+		return func(v semver) bool { return v.compare(want) >= 0 && v.compare(limit) < 0 }, nil
+	case "~":
+		limit := semver{want[0], want[1] + 1}
+		return func(v semver) bool { return v.compare(want) >= 0 && v.compare(limit) < 0 }, nil
+	}
+	return nil, fmt.Errorf("invalid version constraint operator %q", op)
+}
@@ -0,0 +1,54 @@
+package registry
+
+import "testing"
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		match      bool
+	}{
+		{"v1.2.3", "v1.2.3", true},
+		{"v1.2.3", "1.2.3", true},
+		{"v1.2.3", "v1.2.4", false},
+		{"canary", "canary", true},
+		{"canary", "v1.0.0", false},
+		{"v1.2.3", "canary", false},
+		{">=1.2.0 <2.0.0", "v1.2.0", true},
+		{">=1.2.0 <2.0.0", "v1.9.9", true},
+		{">=1.2.0 <2.0.0", "v2.0.0", false},
+		{">=1.2.0, <2.0.0", "v1.1.9", false},
+		{">1.2", "v1.2.1", true},
+		{">1.2", "v1.2.0", false},
+		{"<=1.2", "v1.2.0", true},
+		{"!=1.4.1", "v1.4.1", false},
+		{"!=1.4.1", "v1.4.2", true},
+		{"==1.4.1", "v1.4.1-rc.1", true},
+		{"^1.2", "v1.9.0", true},
+		{"^1.2", "v2.0.0", false},
+		{"^1.2", "v1.1.0", false},
+		{"^0.2.1", "v0.2.5", true},
+		{"^0.2.1", "v0.3.0", false},
+		{"~1.2.3", "v1.2.9", true},
+		{"~1.2.3", "v1.3.0", false},
+		{">=1.0.0", "canary", false},
+	}
+	for _, tt := range tests {
+		match, err := parseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("parseConstraint(%q): %v", tt.constraint, err)
+			continue
+		}
+		if got := match(tt.version); got != tt.match {
+			t.Errorf("constraint %q matching %q = %v, want %v", tt.constraint, tt.version, got, tt.match)
+		}
+	}
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, constraint := range []string{"", " , ", ">=", ">=x.y", "=>1.0.0", "<>1.0.0", ">=1.2.3.4", ">=-1"} {
+		if _, err := parseConstraint(constraint); err == nil {
+			t.Errorf("parseConstraint(%q) succeeded", constraint)
+		}
+	}
+}
@@ -2,6 +2,10 @@ package registry
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/go-kratos/kratos/v2/registry"
@@ -9,41 +13,342 @@ import (
 )
 
 var (
-	_ registry.Watcher = (*watcher)(nil)
+	_ StatsWatcher = (*watcher)(nil)
 )
 
+const keyspaceFormat = "__keyspace@%d__:%s"
+
+// KeyspaceWatcher makes watchers subscribe to keyspace notifications of the
+// service keys and return as soon as one changes. Watchers keep polling, so
+// they still work, with the usual latency, when the server does not have
+// notify-keyspace-events enabled ("Kg$x" is sufficient).
+func KeyspaceWatcher() Option {
+	return func(o *options) { o.keyspace = true }
+}
+
+// database returns the database keyspace notifications are published for,
+// always 0 unless client is a *redis.Client or wraps one, like the client of
+// the rueidis package.
+func database(client redisCmd) int {
+	if c, ok := client.(interface{ Options() *redis.Options }); ok {
+		return c.Options().DB
+	}
+	return 0
+}
+
+// EventWatcher makes watchers subscribe to the events published by the
+// registries of the namespace and only read the service when one of its events
+// arrives. As events are best-effort, watchers still read it every resync
+// interval instead of the WatcherTTL.
+func EventWatcher(resync time.Duration) Option {
+	return func(o *options) { o.resync = resync }
+}
+
+// WatcherFailures makes watchers retry failed reads, with backoff, and only
+// return an error from Next after failures consecutive failed reads. The
+// errors retried are passed to report, which may be nil.
+func WatcherFailures(failures int, report func(error)) Option {
+	return func(o *options) {
+		o.watchFailures = failures
+		o.onWatchError = report
+	}
+}
+
+// WatcherJitter shortens every wait of the watchers by a random amount of up
+// to percent of their interval, so that watchers created at the same time do
+// not poll Redis in bursts.
+func WatcherJitter(percent float64) Option {
+	return func(o *options) { o.watchJitter = percent }
+}
+
+// AdaptiveWatcher makes watchers pick the best change notification the server
+// supports: keyspace notifications when enabled, else the published events,
+// else plain polling. degrade, which may be nil, is called whenever a watcher
+// falls back to polling.
+func AdaptiveWatcher(degrade func(error)) Option {
+	return func(o *options) {
+		o.adaptive = true
+		o.onDegrade = degrade
+	}
+}
+
+// MaxStaleness makes watchers driven by notifications re-read their service at
+// least every maxAge, correcting the drift left by lost notifications, instead
+// of every WatcherTTL.
+func MaxStaleness(maxAge time.Duration) Option {
+	return func(o *options) { o.reconcile = maxAge }
+}
+
+// WatcherDebounce makes watchers wait for window after a change notification
+// before reading the service, coalescing bursts of changes, e.g. during rolling
+// deploys, into a single Next result.
+func WatcherDebounce(window time.Duration) Option {
+	return func(o *options) { o.debounce = window }
+}
+
+// WatchQueue makes every watcher queue up to size reads of its service for
+// Next, so that watchers driven by notifications return each state the
+// service went through instead of only the latest one. overflow decides what
+// happens when a slow consumer lets the queue fill up: OverflowCoalesce makes
+// the next Next return the latest state, OverflowDropOldest skips the oldest
+// queued state, and OverflowBlock holds back the reads of the service.
+func WatchQueue(size int, overflow Overflow) Option {
+	return func(o *options) {
+		o.queueSize = size
+		o.overflow = overflow
+	}
+}
+
+// DetachWatchers ties the lifetime of watchers to the Registry instead of the
+// context passed to Watch, so that a request-scoped context does not end them.
+// They still end on Stop and when the Registry is closed.
+func DetachWatchers() Option {
+	return func(o *options) { o.detach = true }
+}
+
+// watchContext returns the context a watcher created with ctx runs in.
+func (r *Registry) watchContext(ctx context.Context) context.Context {
+	if r.opts.detach {
+		return r.ctx
+	}
+	return ctx
+}
+
+// WatchOption configures a single watcher created by WatchWith.
+type WatchOption func(o *watchOptions)
+
+type watchOptions struct {
+	interval time.Duration
+	filters  []func(*registry.ServiceInstance) bool
+	invalid  error
+}
+
+// WatchInterval polls at interval instead of the WatcherTTL of the Registry.
+func WatchInterval(interval time.Duration) WatchOption {
+	return func(o *watchOptions) { o.interval = interval }
+}
+
+// WatchFilter hides instances for which keep returns false from the watcher,
+// on top of the filters of the Registry.
+func WatchFilter(keep func(*registry.ServiceInstance) bool) WatchOption {
+	return func(o *watchOptions) { o.filters = append(o.filters, keep) }
+}
+
+// WatchVersion only reports instances whose Version satisfies the constraint,
+// see VersionConstraint.
+func WatchVersion(constraint string) WatchOption {
+	return func(o *watchOptions) {
+		match, err := parseConstraint(constraint)
+		if err != nil {
+			o.invalid = err
+			return
+		}
+		o.filters = append(o.filters, func(si *registry.ServiceInstance) bool {
+			return match(si.Version)
+		})
+	}
+}
+
+// WatchSelector only reports instances whose metadata matches the label
+// selector, see Selector.
+func WatchSelector(selector string) WatchOption {
+	return func(o *watchOptions) {
+		match, err := parseSelector(selector)
+		if err != nil {
+			o.invalid = err
+			return
+		}
+		o.filters = append(o.filters, func(si *registry.ServiceInstance) bool {
+			return match(si.Metadata)
+		})
+	}
+}
+
+// WatcherStats tells how fresh the data of a watcher is, so that operators can
+// alert when discovery goes stale.
+type WatcherStats struct {
+	// LastRefresh is when the service was last read successfully.
+	LastRefresh time.Time
+	// Failures counts the consecutive failed reads.
+	Failures int
+	// Mechanism is MechanismPoll, MechanismEvents or MechanismKeyspace.
+	Mechanism string
+}
+
+// StatsWatcher is implemented by the watchers returned by Watch and WatchWith.
+type StatsWatcher interface {
+	registry.Watcher
+	Stats() WatcherStats
+}
+
+// stopper makes Stop idempotent and safe for concurrent use, and tells the
+// errors of a stopped watcher apart from those of its context.
+type stopper struct {
+	once    sync.Once
+	stopped chan struct{}
+}
+
+func newStopper() stopper {
+	return stopper{stopped: make(chan struct{})}
+}
+
+// stop runs release on the first call only.
+func (s *stopper) stop(release func()) {
+	s.once.Do(func() {
+		close(s.stopped)
+		release()
+	})
+}
+
+// err returns ErrWatcherStopped instead of err once stopped.
+func (s *stopper) err(err error) error {
+	if err == nil {
+		return nil
+	}
+	select {
+	case <-s.stopped:
+		return ErrWatcherStopped
+	default:
+		return err
+	}
+}
+
+// watcher consumes the poller shared by all watchers of the service polling
+// at the same interval.
 type watcher struct {
-	key    string
-	ticker *time.Ticker
-	ctx    context.Context
-	cancel context.CancelFunc
-	client *redis.Client
+	p       *poller
+	filters []func(*registry.ServiceInstance) bool
+	seq     uint64
+	failed  int
+	last    uint64
+	seen    bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	// queued reads with WatchQueue, nil to only read the latest one
+	queue *queue
+	stopper
 }
 
-func newWatcher(ctx context.Context, key string, client *redis.Client, ttl time.Duration) *watcher {
+func newWatcher(ctx context.Context, r *Registry, service string, opts ...WatchOption) (*watcher, error) {
+	o := &watchOptions{interval: r.opts.watcherTtl}
+	if r.opts.resync > 0 {
+		o.interval = r.opts.resync
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.invalid != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, o.invalid)
+	}
 	w := &watcher{
-		key:    key,
-		ticker: time.NewTicker(ttl),
-		client: client,
+		p:       r.subscribe(service, o.interval),
+		filters: o.filters,
+		stopper: newStopper(),
 	}
-	w.ctx, w.cancel = context.WithCancel(ctx)
-	return w
+	w.ctx, w.cancel = context.WithCancel(r.watchContext(ctx))
+	if r.opts.queueSize > 0 {
+		w.queue = newQueue(r.opts.queueSize, r.opts.overflow, pollResync)
+		w.p.attach(w.queue)
+	}
+	return w, nil
 }
 
+// Next returns the current instances right away on the first call, then
+// blocks until they differ from those it returned last.
 func (w *watcher) Next() ([]*registry.ServiceInstance, error) {
+	items, err := w.next()
+	return items, w.err(err)
+}
+
+func (w *watcher) next() ([]*registry.ServiceInstance, error) {
 	for {
-		select {
-		case <-w.ctx.Done():
-			return nil, w.ctx.Err()
-		case <-w.ticker.C:
+		items, seq, err := w.receive()
+		if seq == 0 {
+			return nil, err
+		}
+		w.seq = seq
+		if err != nil {
+			if w.failed++; w.failed <= w.p.r.opts.watchFailures {
+				if report := w.p.r.opts.onWatchError; report != nil {
+					report(err)
+				}
+				continue
+			}
+			w.failed = 0
+			return nil, err
+		}
+		w.failed = 0
+		items = filter(copyInstances(items), w.filters)
+		sum := fingerprint(items)
+		if w.seen && sum == w.last {
+			continue
 		}
-		return services(w.ctx, w.client, w.key)
+		w.last, w.seen = sum, true
+		return items, nil
+	}
+}
+
+// receive returns the next read of the service, from the queue with WatchQueue.
+func (w *watcher) receive() ([]*registry.ServiceInstance, uint64, error) {
+	if w.queue == nil {
+		return w.p.next(w.ctx, w.seq)
+	}
+	v, err := w.queue.pop(w.ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	result := v.(*pollResult)
+	if result == pollResync {
+		// fell behind, skip to the latest read
+		return w.p.next(w.ctx, 0)
 	}
+	return result.items, result.seq, result.err
+}
+
+func (w *watcher) Stats() WatcherStats {
+	return w.p.stats()
 }
 
 func (w *watcher) Stop() error {
-	w.ticker.Stop()
-	w.cancel()
+	w.stop(func() {
+		w.cancel()
+		if w.queue != nil {
+			w.p.detach(w.queue)
+		}
+		w.p.r.unsubscribe(w.p)
+	})
 
 	return nil
 }
+
+// fingerprint hashes the ordered instances, ignoring the synthetic metadata
+// that changes on every heartbeat.
+func fingerprint(items []*registry.ServiceInstance) uint64 {
+	h := fnv.New64a()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	for _, si := range items {
+		write(si.ID)
+		write(si.Name)
+		write(si.Version)
+		for _, e := range si.Endpoints {
+			write(e)
+		}
+		h.Write([]byte{2})
+		keys := make([]string, 0, len(si.Metadata))
+		for k := range si.Metadata {
+			if !syntheticMetadata[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			write(k)
+			write(si.Metadata[k])
+		}
+		h.Write([]byte{1})
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-redis/redis/v8"
+)
+
+// SortedSetLayout keeps the instance keys of a service in a sorted set scored
+// by their expiration, instead of the set of Index, which it implies. Renewals
+// update the score, discovery reads the members not expired yet with a single
+// ZRANGEBYSCORE before reading their keys, and a janitor removes the expired
+// members every TTL. It cannot be combined with SnapshotReads or HashLayout,
+// and every Registry of the namespace must use it.
+func SortedSetLayout() Option {
+	return func(o *options) {
+		o.zset = true
+		o.index = true
+	}
+}
+
+// zsetLayout writes the instance key KEYS[1] and scores it with the
+// expiration ARGV[3] in the sorted set KEYS[2].
+var zsetLayout = layout{
+	register:   redis.NewScript(zsetRegisterSource),
+	registerNX: redis.NewScript(zsetRegisterNXSource),
+	deregister: redis.NewScript(zsetDeregisterSource),
+}
+
+// zsetWriteSource defines write(), which stores the instance and scores it.
+const zsetWriteSource = `
+local function write()
+	if tonumber(ARGV[2]) > 0 then
+		redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	else
+		redis.call("SET", KEYS[1], ARGV[1])
+	end
+	redis.call("ZADD", KEYS[2], ARGV[3], KEYS[1])
+end
+`
+
+const zsetRegisterSource = zsetWriteSource + `
+local existed = redis.call("EXISTS", KEYS[1])
+write()
+return existed
+`
+
+const zsetRegisterNXSource = zsetWriteSource + sameInstanceSource + `
+local current = redis.call("GET", KEYS[1])
+if current and not same(current, ARGV[1]) then
+	return 0
+end
+write()
+return 1
+`
+
+const zsetDeregisterSource = `
+redis.call("DEL", KEYS[1])
+redis.call("ZREM", KEYS[2], KEYS[1])
+return 1
+`
+
+// score returns the sorted set score of an instance expiring after expiry.
+func score(expiry time.Duration) string {
+	if expiry <= 0 {
+		return "+inf"
+	}
+	return strconv.FormatInt(millis(time.Now().Add(expiry)), 10)
+}
+
+// scored reads the instances whose score is not expired yet.
+func (r *Registry) scored(ctx context.Context, service string) ([]*registry.ServiceInstance, error) {
+	keys, err := r.reader.ZRangeByScore(ctx, r.index(service), &redis.ZRangeBy{
+		Min: strconv.FormatInt(millis(time.Now()), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := mget(ctx, r.reader, keys)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*registry.ServiceInstance, 0, len(keys))
+	for i, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			// deregistered meanwhile
+			continue
+		}
+		si, err := decode(str)
+		if err != nil {
+			if err = r.malformed(keys[i], err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		items = append(items, si)
+	}
+	return items, nil
+}
+
+// countScored counts the members of the sorted set of the service that are
+// not expired yet.
+func (r *Registry) countScored(ctx context.Context, service string) (int64, error) {
+	return r.reader.ZCount(ctx, r.index(service), strconv.FormatInt(millis(time.Now()), 10), "+inf").Result()
+}
+
+// sweepScores removes the expired members of every sorted set of the namespace.
+func (r *Registry) sweepScores(ctx context.Context) error {
+	prefix, suffix := r.indexAffixes()
+	return r.scanKeys(ctx, r.client, prefix+"*"+suffix, func(keys []string) error {
+		now := strconv.FormatInt(millis(time.Now()), 10)
+		for _, key := range keys {
+			if err := r.client.ZRemRangeByScore(ctx, key, "-inf", "("+now).Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,131 @@
+// Package rueidis serves the reads of a kratos-redis Registry from the RESP3
+// client-side cache of a rueidis client.
+package rueidis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/redis/rueidis"
+)
+
+const defaultCacheTTL = time.Minute
+
+// Client is a redis.UniversalClient to pass to registry.New. It sends GET,
+// MGET, SMEMBERS, SCARD, HGETALL and HLEN, alone or in pipelines, through the
+// client-side cache of a rueidis client, which Redis invalidates whenever the
+// keys read change, and every other command to the go-redis client it wraps.
+//
+// With Index, GetService and watchers are then served from memory until an
+// instance of the service is written, renewed or expires. Without it the
+// keyspace is still scanned on every read and only the values are cached.
+type Client struct {
+	redis.UniversalClient
+
+	cache rueidis.Client
+	ttl   time.Duration
+}
+
+// Option configures a Client.
+type Option func(c *Client)
+
+// CacheTTL bounds how long a value stays cached without being read from
+// Redis again, a minute by default. Redis reports the changes anyway, the TTL
+// only limits the memory held by values no longer read.
+func CacheTTL(ttl time.Duration) Option {
+	return func(c *Client) { c.ttl = ttl }
+}
+
+// NewClient returns a Client reading through cache, a rueidis client of the
+// same deployment and database as client, which must not disable client-side
+// caching.
+func NewClient(client redis.UniversalClient, cache rueidis.Client, opts ...Option) (*Client, error) {
+	c := &Client{UniversalClient: client, cache: cache, ttl: defaultCacheTTL}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.ttl <= 0 {
+		return nil, fmt.Errorf("rueidis: non-positive cache TTL %v", c.ttl)
+	}
+	return c, nil
+}
+
+// Options returns the options of the wrapped client when it is a
+// *redis.Client, so that keyspace notifications are watched on its database.
+func (c *Client) Options() *redis.Options {
+	if client, ok := c.UniversalClient.(*redis.Client); ok {
+		return client.Options()
+	}
+	return &redis.Options{}
+}
+
+// Close closes both clients.
+func (c *Client) Close() error {
+	c.cache.Close()
+	return c.UniversalClient.Close()
+}
+
+// nilErr translates the nil replies of rueidis to those of go-redis.
+func nilErr(err error) error {
+	if rueidis.IsRedisNil(err) {
+		return redis.Nil
+	}
+	return err
+}
+
+func (c *Client) cached(ctx context.Context, cmd rueidis.Cacheable) rueidis.RedisResult {
+	return c.cache.DoCache(ctx, cmd, c.ttl)
+}
+
+func (c *Client) Get(ctx context.Context, key string) *redis.StringCmd {
+	v, err := c.cached(ctx, c.cache.B().Get().Key(key).Cache()).ToString()
+	return redis.NewStringResult(v, nilErr(err))
+}
+
+// MGet is sent as one GET per key, so that keys of different slots can be
+// read and every key is invalidated on its own.
+func (c *Client) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	cmds := make([]rueidis.CacheableTTL, len(keys))
+	for i, key := range keys {
+		cmds[i] = rueidis.CT(c.cache.B().Get().Key(key).Cache(), c.ttl)
+	}
+	values, err := values(c.cache.DoMultiCache(ctx, cmds...))
+	return redis.NewSliceResult(values, err)
+}
+
+// values returns the replies of GET commands, nil for missing keys.
+func values(results []rueidis.RedisResult) ([]interface{}, error) {
+	values := make([]interface{}, len(results))
+	for i, result := range results {
+		v, err := result.ToString()
+		switch {
+		case err == nil:
+			values[i] = v
+		case !rueidis.IsRedisNil(err):
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (c *Client) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	members, err := c.cached(ctx, c.cache.B().Smembers().Key(key).Cache()).AsStrSlice()
+	return redis.NewStringSliceResult(members, nilErr(err))
+}
+
+func (c *Client) SCard(ctx context.Context, key string) *redis.IntCmd {
+	n, err := c.cached(ctx, c.cache.B().Scard().Key(key).Cache()).AsInt64()
+	return redis.NewIntResult(n, nilErr(err))
+}
+
+func (c *Client) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	fields, err := c.cached(ctx, c.cache.B().Hgetall().Key(key).Cache()).AsStrMap()
+	return redis.NewStringStringMapResult(fields, nilErr(err))
+}
+
+func (c *Client) HLen(ctx context.Context, key string) *redis.IntCmd {
+	n, err := c.cached(ctx, c.cache.B().Hlen().Key(key).Cache()).AsInt64()
+	return redis.NewIntResult(n, nilErr(err))
+}
@@ -0,0 +1,13 @@
+module github.com/exuan/kratos-redis/rueidis
+
+go 1.20
+
+require (
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/redis/rueidis v1.0.14
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+)
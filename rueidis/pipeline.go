@@ -0,0 +1,72 @@
+package rueidis
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/redis/rueidis"
+)
+
+// pipeline queues GET and MGET for the client-side cache and every other
+// command in the go-redis pipeline it wraps.
+type pipeline struct {
+	redis.Pipeliner
+
+	c      *Client
+	cached []rueidis.CacheableTTL
+	// fill sets the results of the queued reads, returning their error
+	fill []func(results []rueidis.RedisResult) error
+}
+
+// Pipelined runs the reads queued by fn through the client-side cache, with a
+// single DoMultiCache, and the other commands in a go-redis pipeline. Like
+// go-redis, it returns the first error of the commands.
+func (c *Client) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	p := &pipeline{Pipeliner: c.UniversalClient.Pipeline(), c: c}
+	defer p.Pipeliner.Close()
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	cmds, err := p.Pipeliner.Exec(ctx)
+	if len(p.cached) > 0 {
+		results := c.cache.DoMultiCache(ctx, p.cached...)
+		for _, fill := range p.fill {
+			if ferr := fill(results); ferr != nil && err == nil {
+				err = ferr
+			}
+		}
+	}
+	return cmds, err
+}
+
+func (p *pipeline) queue(key string) int {
+	p.cached = append(p.cached, rueidis.CT(p.c.cache.B().Get().Key(key).Cache(), p.c.ttl))
+	return len(p.cached) - 1
+}
+
+// Get and MGet return commands replaced by their results once the pipeline
+// ran, as go-redis v8 commands cannot be given a value.
+func (p *pipeline) Get(ctx context.Context, key string) *redis.StringCmd {
+	cmd := new(redis.StringCmd)
+	i := p.queue(key)
+	p.fill = append(p.fill, func(results []rueidis.RedisResult) error {
+		v, err := results[i].ToString()
+		*cmd = *redis.NewStringResult(v, nilErr(err))
+		return cmd.Err()
+	})
+	return cmd
+}
+
+func (p *pipeline) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	cmd := new(redis.SliceCmd)
+	first := len(p.cached)
+	for _, key := range keys {
+		p.queue(key)
+	}
+	p.fill = append(p.fill, func(results []rueidis.RedisResult) error {
+		values, err := values(results[first : first+len(keys)])
+		*cmd = *redis.NewSliceResult(values, err)
+		return err
+	})
+	return cmd
+}